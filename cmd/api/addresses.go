@@ -1,17 +1,48 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
 	"github.com/AmoabaKelvin/temp-mail/internal/store"
 	gonanoid "github.com/matoous/go-nanoid/v2"
 )
 
+// randomLocalPartAlphabet keeps generated addresses lower case, which is how recipients are
+// looked up
+const randomLocalPartAlphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+var localPartPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9._+-]{0,62}[a-z0-9])?$`)
+
+// reservedLocalParts are role accounts that can't be claimed, so nobody receives mail meant for the domain
+var reservedLocalParts = []string{
+	"abuse", "admin", "administrator", "billing", "contact", "help", "hostmaster", "info",
+	"mailer-daemon", "noc", "no-reply", "noreply", "nobody", "postmaster", "root", "sales",
+	"security", "support", "webmaster",
+}
+
+// blockedWords are rejected anywhere in a chosen local part
+var blockedWords = []string{
+	"asshole", "bitch", "cunt", "dick", "fag", "fuck", "nazi", "nigg", "porn", "rape",
+	"retard", "shit", "slut", "whore",
+}
+
+type createAddressRequest struct {
+	LocalPart string `json:"local_part"`
+	Domain    string `json:"domain"`
+	TTL       string `json:"ttl"` // Go duration, e.g. "90m"
+}
+
 func (app *application) newRandomAddress() store.Address {
-	id, err := gonanoid.New()
+	id, err := gonanoid.Generate(randomLocalPartAlphabet, 21)
 	if err != nil {
 		panic(err)
 	}
@@ -28,13 +59,207 @@ func (app *application) newRandomAddress() store.Address {
 	}
 }
 
-func (app *application) generateAddress(w http.ResponseWriter, r *http.Request) {
+// newRequestedAddress applies the choices in the request on top of a random address,
+// returning a message for the client when one of them is not allowed
+func (app *application) newRequestedAddress(req createAddressRequest) (store.Address, string) {
 	address := app.newRandomAddress()
+	localPart, domain, _ := strings.Cut(address.Email, "@")
+
+	if req.LocalPart != "" {
+		localPart = strings.ToLower(strings.TrimSpace(req.LocalPart))
+		if msg := validateLocalPart(localPart); msg != "" {
+			return store.Address{}, msg
+		}
+	}
+
+	if req.Domain != "" {
+		domain = strings.ToLower(strings.TrimSpace(req.Domain))
+		if !slices.Contains(app.config.tempMail.domains, domain) {
+			return store.Address{}, fmt.Sprintf("domain must be one of: %s", strings.Join(app.config.tempMail.domains, ", "))
+		}
+	}
+
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return store.Address{}, "ttl must be a positive duration such as 30m or 2h"
+		}
+		if ttl > app.config.tempMail.maxTTL {
+			return store.Address{}, fmt.Sprintf("ttl must not be longer than %s", app.config.tempMail.maxTTL)
+		}
+		address.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	address.Email = localPart + "@" + domain
+	return address, ""
+}
+
+// validateLocalPart checks a local part chosen by the client, returning why it was rejected
+func validateLocalPart(localPart string) string {
+	if !localPartPattern.MatchString(localPart) || strings.Contains(localPart, "..") {
+		return "local_part must be 1 to 64 lowercase letters, digits, dots, dashes, underscores or plus signs, starting and ending with a letter or digit"
+	}
+
+	if slices.Contains(reservedLocalParts, localPart) {
+		return "local_part is reserved"
+	}
+
+	for _, word := range blockedWords {
+		if strings.Contains(localPart, word) {
+			return "local_part is not allowed"
+		}
+	}
+
+	return ""
+}
+
+func (app *application) generateAddress(w http.ResponseWriter, r *http.Request) {
+	// The body is optional, an empty one creates a random address
+	var req createAddressRequest
+	if err := app.readJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequest(w, "invalid request body")
+		return
+	}
+
+	address, msg := app.newRequestedAddress(req)
+	if msg != "" {
+		app.badRequest(w, msg)
+		return
+	}
+
+	token, tokenHash, err := generateToken()
+	if err != nil {
+		app.serverError(w)
+		return
+	}
+	address.Token = token
+	address.TokenHash = tokenHash
 
 	if err := app.store.Addresses.Create(r.Context(), &address); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			app.conflict(w, "address is already taken")
+			return
+		}
 		app.serverError(w)
 		return
 	}
 
 	app.writeJSON(w, http.StatusCreated, address, nil)
 }
+
+type extendAddressRequest struct {
+	TTL string `json:"ttl"` // Go duration added to the current expiry, defaults to EXPIRE_AFTER
+}
+
+// getAddress returns the authenticated address with its expiry and message counts
+func (app *application) getAddress(w http.ResponseWriter, r *http.Request) {
+	address := *getAddressFromContext(r)
+
+	if err := app.loadMessageCounts(r, &address); err != nil {
+		app.serverError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, address, nil)
+}
+
+// loadMessageCounts sets the total and unread message counts of an address
+func (app *application) loadMessageCounts(r *http.Request, address *store.Address) error {
+	total, unread, err := app.store.Messages.Count(r.Context(), address.ID)
+	if err != nil {
+		return err
+	}
+
+	address.MessageCount = total
+	address.UnreadCount = unread
+	return nil
+}
+
+// extendAddress pushes the expiry of an address back. The new expiry can't be further than
+// MAX_TTL from now, nor further than MAX_LIFETIME from when the address was created.
+func (app *application) extendAddress(w http.ResponseWriter, r *http.Request) {
+	var req extendAddressRequest
+	if err := app.readJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequest(w, "invalid request body")
+		return
+	}
+
+	if req.TTL == "" {
+		req.TTL = app.config.tempMail.expireAfter
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil || ttl <= 0 {
+		app.badRequest(w, "ttl must be a positive duration such as 30m or 2h")
+		return
+	}
+
+	address := *getAddressFromContext(r)
+	now := time.Now()
+	// Expired addresses are about to be swept and stay expired, even if the sweeper is behind
+	if !address.ExpiresAt.After(now) {
+		app.gone(w, "address has expired")
+		return
+	}
+	expiresAt := address.ExpiresAt.Add(ttl)
+
+	if expiresAt.After(now.Add(app.config.tempMail.maxTTL)) {
+		app.badRequest(w, fmt.Sprintf("addresses can't be kept alive for more than %s from now", app.config.tempMail.maxTTL))
+		return
+	}
+	if expiresAt.After(address.CreatedAt.Add(app.config.tempMail.maxLifetime)) {
+		app.badRequest(w, fmt.Sprintf("addresses can't live for more than %s after they were created", app.config.tempMail.maxLifetime))
+		return
+	}
+
+	if err := app.store.Addresses.SetExpiresAt(r.Context(), address.ID, expiresAt); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w)
+		default:
+			app.serverError(w)
+		}
+		return
+	}
+	address.ExpiresAt = expiresAt
+
+	if err := app.loadMessageCounts(r, &address); err != nil {
+		app.serverError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, address, nil)
+}
+
+// markAllMessagesRead marks every unread message of the address read
+func (app *application) markAllMessagesRead(w http.ResponseWriter, r *http.Request) {
+	address := getAddressFromContext(r)
+
+	updated, err := app.store.Messages.MarkAllRead(r.Context(), address.ID, time.Now())
+	if err != nil {
+		app.serverError(w)
+		return
+	}
+
+	if updated > 0 {
+		app.publish(r, events.Event{Type: events.MessageRead, AddressID: address.ID})
+	}
+
+	app.writeJSON(w, http.StatusOK, map[string]int64{"updated": updated}, nil)
+}
+
+// deleteAddress deletes the authenticated address and everything it received
+func (app *application) deleteAddress(w http.ResponseWriter, r *http.Request) {
+	address := getAddressFromContext(r)
+
+	if err := app.store.Addresses.Delete(r.Context(), address.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w)
+		default:
+			app.serverError(w)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, map[string]string{"message": "Address deleted successfully"}, nil)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtendAddress(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.tempMail.maxTTL = 3 * time.Hour
+	app.config.tempMail.maxLifetime = 2 * time.Hour
+	handler := app.mount()
+	address, token := createTestAddress(t, app, handler, "alice")
+	path := "/v1/addresses/alice@example.com/extend"
+
+	// The address starts out expiring an hour after it was created
+	tests := []struct {
+		name  string
+		ttl   string
+		want  int
+		error string
+	}{
+		{"invalid ttl", "soon", http.StatusBadRequest, "ttl must be a positive duration"},
+		{"negative ttl", "-1h", http.StatusBadRequest, "ttl must be a positive duration"},
+		{"beyond MAX_TTL", "2h30m", http.StatusBadRequest, "more than 3h0m0s from now"},
+		{"beyond MAX_LIFETIME", "1h30m", http.StatusBadRequest, "more than 2h0m0s after they were created"},
+		{"within the limits", "30m", http.StatusOK, ""},
+	}
+
+	expiresAt := address.ExpiresAt
+	for _, tt := range tests {
+		rec := doRequest(t, handler, http.MethodPost, path, token, extendAddressRequest{TTL: tt.ttl})
+		if rec.Code != tt.want {
+			t.Fatalf("%s: extending by %s returned %d, want %d: %s", tt.name, tt.ttl, rec.Code, tt.want, rec.Body)
+		}
+		if tt.error != "" && !strings.Contains(rec.Body.String(), tt.error) {
+			t.Errorf("%s: extending by %s returned %s, want an error containing %q", tt.name, tt.ttl, rec.Body, tt.error)
+		}
+
+		stored, err := app.store.Addresses.Get(context.Background(), address.Email)
+		if err != nil {
+			t.Fatalf("failed to get %s: %v", address.Email, err)
+		}
+		if tt.want == http.StatusOK {
+			ttl, _ := time.ParseDuration(tt.ttl)
+			expiresAt = expiresAt.Add(ttl)
+		}
+		if !stored.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("%s: address expires at %s, want %s", tt.name, stored.ExpiresAt, expiresAt)
+		}
+	}
+}
+
+func TestExtendExpiredAddress(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.mount()
+	address, token := createTestAddress(t, app, handler, "alice")
+	expiredAt := time.Now().Add(-time.Minute)
+	if err := app.store.Addresses.SetExpiresAt(context.Background(), address.ID, expiredAt); err != nil {
+		t.Fatalf("SetExpiresAt failed: %v", err)
+	}
+
+	rec := doRequest(t, handler, http.MethodPost, "/v1/addresses/alice@example.com/extend", token, extendAddressRequest{TTL: "1h"})
+	if rec.Code != http.StatusGone {
+		t.Fatalf("extending an expired address returned %d, want %d: %s", rec.Code, http.StatusGone, rec.Body)
+	}
+
+	stored, err := app.store.Addresses.Get(context.Background(), address.Email)
+	if err != nil {
+		t.Fatalf("failed to get %s: %v", address.Email, err)
+	}
+	if stored.ExpiresAt.After(time.Now()) {
+		t.Errorf("extending revived the address until %s", stored.ExpiresAt)
+	}
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"expvar"
+	"log"
 	"net/http"
+	"os"
+	"runtime"
+	"time"
 
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
 	"github.com/AmoabaKelvin/temp-mail/internal/store"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -12,12 +18,16 @@ import (
 type application struct {
 	config *config
 	store  *store.Storage
+	events events.Bus
 }
 
 type config struct {
-	addr     string
-	db       *dbConfig
-	tempMail *tempMailConfig
+	addr      string
+	debugAddr string // serves /debug/vars when set, kept off the public listener
+	db        *dbConfig
+	tempMail  *tempMailConfig
+	// webhookAllowPrivate lets webhooks target loopback and private addresses, for local testing
+	webhookAllowPrivate bool
 }
 
 type dbConfig struct {
@@ -27,29 +37,68 @@ type dbConfig struct {
 type tempMailConfig struct {
 	domains           []string
 	expireAfter       string
-	expirationEnabled string
+	maxTTL            time.Duration // longest time an address can be kept alive from now
+	maxLifetime       time.Duration // longest time an address can exist after it was created
+	expirationEnabled bool
+	sweepInterval     time.Duration
+	trashGracePeriod  time.Duration // how long deleted messages can be restored
 }
 
+var allowedOrigins = []string{"http://localhost:3000", "http://localhost:3000/*", "https://www.is-temp.com"}
+
 func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(requestLogger())
 
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:3000/*", "https://www.is-temp.com"},
+		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "Content-Disposition", nextCursorHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	r.Route("/v1", func(r chi.Router) {
-		r.Post("/addresses", app.generateAddress)
+		r.Get("/ws", app.inboxWebSocket)
+		r.Route("/addresses", func(r chi.Router) {
+			r.Post("/", app.generateAddress)
+			r.Route("/{email}", func(r chi.Router) {
+				r.With(app.requireStreamToken, app.addressCtx).Get("/events", app.streamAddressEvents)
+				r.Group(func(r chi.Router) {
+					r.Use(app.requireAddressToken, app.addressCtx)
+					r.Get("/", app.getAddress)
+					r.Delete("/", app.deleteAddress)
+					r.Post("/extend", app.extendAddress)
+					r.Post("/read-all", app.markAllMessagesRead)
+					r.Route("/webhooks", func(r chi.Router) {
+						r.Get("/", app.getWebhooks)
+						r.Post("/", app.createWebhook)
+						r.Delete("/{webhookID}", app.deleteWebhook)
+						r.Get("/{webhookID}/attempts", app.getWebhookAttempts)
+					})
+				})
+			})
+		})
 		r.Route("/messages", func(r chi.Router) {
+			r.Use(app.requireAddressToken)
 			r.Get("/", app.getMessages)
+			r.Get("/wait", app.waitForMessage)
+			r.Get("/search", app.searchMessages)
+			// Trashed messages can't be loaded by messageCtx
+			r.Post("/{id}/restore", app.restoreMessage)
 			r.Route("/{id}", func(r chi.Router) {
+				r.Use(app.messageCtx)
+				r.Get("/", app.getMessage)
 				r.Delete("/", app.deleteMessage)
 				r.Put("/read", app.updateMessageReadAt)
+				r.Delete("/read", app.markMessageUnread)
+				r.Get("/raw", app.downloadRawMessage)
+				r.Get("/codes", app.getMessageCodes)
+				r.Route("/attachments", func(r chi.Router) {
+					r.Get("/", app.getMessageAttachments)
+					r.Get("/{attachmentID}", app.downloadAttachment)
+				})
 			})
 		})
 	})
@@ -57,6 +106,34 @@ func (app *application) mount() http.Handler {
 	return r
 }
 
+// redactingLogFormatter keeps access tokens passed in the query string out of the request log
+type redactingLogFormatter struct {
+	middleware.LogFormatter
+}
+
+func (f redactingLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	query := r.URL.Query()
+	if !query.Has("access_token") {
+		return f.LogFormatter.NewLogEntry(r)
+	}
+
+	query.Set("access_token", "REDACTED")
+	redactedURL := *r.URL
+	redactedURL.RawQuery = query.Encode()
+
+	redacted := *r
+	redacted.URL = &redactedURL
+	redacted.RequestURI = redactedURL.RequestURI()
+	return f.LogFormatter.NewLogEntry(&redacted)
+}
+
+// requestLogger is middleware.Logger with access tokens redacted
+func requestLogger() func(http.Handler) http.Handler {
+	return middleware.RequestLogger(redactingLogFormatter{
+		LogFormatter: &middleware.DefaultLogFormatter{Logger: log.New(os.Stdout, "", log.LstdFlags), NoColor: runtime.GOOS == "windows"},
+	})
+}
+
 func (app *application) run(routes http.Handler) error {
 	server := &http.Server{
 		Addr:    app.config.addr,
@@ -65,3 +142,17 @@ func (app *application) run(routes http.Handler) error {
 
 	return server.ListenAndServe()
 }
+
+// runDebug serves the expvar counters on their own listener, which should only be reachable
+// from inside the deployment
+func (app *application) runDebug() error {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	server := &http.Server{
+		Addr:    app.config.debugAddr,
+		Handler: mux,
+	}
+
+	return server.ListenAndServe()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+// newTestApplication returns an application on memory storage serving example.com
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	return &application{
+		config: &config{
+			tempMail: &tempMailConfig{
+				domains:     []string{"example.com"},
+				expireAfter: "1h",
+				maxTTL:      24 * time.Hour,
+				maxLifetime: 7 * 24 * time.Hour,
+			},
+		},
+		store:  store.NewMemoryStorage(),
+		events: events.NewLocalBus(),
+	}
+}
+
+// doRequest sends a request to handler, encoding body as JSON when it is set
+func doRequest(t *testing.T, handler http.Handler, method, path, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatalf("failed to encode request body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &reader)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeData decodes the data of a response envelope into out
+func decodeData(t *testing.T, rec *httptest.ResponseRecorder, out any) {
+	t.Helper()
+
+	envelope := struct {
+		Data any `json:"data"`
+	}{Data: out}
+	if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+// createTestAddress creates localPart@example.com through the API, returning the stored
+// address and its access token
+func createTestAddress(t *testing.T, app *application, handler http.Handler, localPart string) (*store.Address, string) {
+	t.Helper()
+
+	rec := doRequest(t, handler, http.MethodPost, "/v1/addresses", "", createAddressRequest{LocalPart: localPart})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("creating %s returned %d: %s", localPart, rec.Code, rec.Body)
+	}
+	var created store.Address
+	decodeData(t, rec, &created)
+
+	address, err := app.store.Addresses.Get(context.Background(), created.Email)
+	if err != nil {
+		t.Fatalf("failed to get %s: %v", created.Email, err)
+	}
+	return address, created.Token
+}
+
+// createTestMessage stores a message with one attachment for address
+func createTestMessage(t *testing.T, app *application, address *store.Address, subject string) *store.Message {
+	t.Helper()
+
+	message := &store.Message{
+		FromAddress: "sender@example.com",
+		ToAddressID: uint(address.ID),
+		Subject:     subject,
+		Snippet:     subject,
+		Headers:     []byte(`{}`),
+		ReceivedAt:  time.Now(),
+		Attachments: []store.Attachment{{Filename: "a.txt", ContentType: "text/plain", Size: 4, Content: []byte("data")}},
+	}
+	if err := app.store.Messages.Create(context.Background(), message); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	return message
+}
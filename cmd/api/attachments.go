@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+func (app *application) getMessageAttachments(w http.ResponseWriter, r *http.Request) {
+	message := getMessageFromContext(r)
+
+	attachments, err := app.store.Attachments.GetByMessageID(r.Context(), int64(message.ID))
+	if err != nil {
+		app.serverError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, attachments, nil)
+}
+
+func (app *application) downloadAttachment(w http.ResponseWriter, r *http.Request) {
+	message := getMessageFromContext(r)
+
+	attachmentID, err := app.readIDParam(r, "attachmentID")
+	if err != nil {
+		app.badRequest(w, "invalid attachment ID")
+		return
+	}
+
+	attachment, err := app.store.Attachments.GetByID(r.Context(), int64(message.ID), attachmentID)
+	if errors.Is(err, store.ErrNotFound) {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(attachment.Content)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type contextKey string
+
+const (
+	addressContextKey = contextKey("address")
+	messageContextKey = contextKey("message")
+)
+
+// generateToken returns a new random access token and the hash that is stored for it
+func generateToken() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// requireAddressToken resolves the address owning the bearer token in the Authorization header
+func (app *application) requireAddressToken(next http.Handler) http.Handler {
+	return app.authenticateAddress(next, false)
+}
+
+// requireStreamToken is requireAddressToken for event streams. Browsers can't set headers on
+// EventSource connections, so the token is also accepted in the access_token query parameter.
+// Only stream routes accept it, URLs end up in logs and browser history.
+func (app *application) requireStreamToken(next http.Handler) http.Handler {
+	return app.authenticateAddress(next, true)
+}
+
+func (app *application) authenticateAddress(next http.Handler, allowQueryToken bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = ""
+			if allowQueryToken {
+				token = r.URL.Query().Get("access_token")
+			}
+		}
+		if token == "" {
+			app.unauthorized(w)
+			return
+		}
+
+		address, err := app.store.Addresses.GetByTokenHash(r.Context(), hashToken(token))
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorized(w)
+			return
+		} else if errors.Is(err, store.ErrExpired) {
+			app.gone(w, "address has expired")
+			return
+		} else if err != nil {
+			app.serverError(w)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), addressContextKey, address)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getAddressFromContext(r *http.Request) *store.Address {
+	return r.Context().Value(addressContextKey).(*store.Address)
+}
+
+// addressCtx rejects requests for an {email} other than the authenticated address
+func (app *application) addressCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email, err := url.PathUnescape(chi.URLParam(r, "email"))
+		if err != nil {
+			app.badRequest(w, "invalid email address")
+			return
+		}
+
+		if !strings.EqualFold(getAddressFromContext(r).Email, email) {
+			app.forbidden(w)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// messageCtx loads the message in the {id} URL parameter, rejecting messages that
+// belong to a different address than the authenticated one
+func (app *application) messageCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r, "id")
+		if err != nil {
+			app.badRequest(w, "invalid message ID")
+			return
+		}
+
+		message, err := app.store.Messages.GetByID(r.Context(), id)
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFound(w)
+			return
+		} else if err != nil {
+			app.serverError(w)
+			return
+		}
+
+		if int64(message.ToAddressID) != getAddressFromContext(r).ID {
+			app.forbidden(w)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), messageContextKey, message)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getMessageFromContext(r *http.Request) *store.Message {
+	return r.Context().Value(messageContextKey).(*store.Message)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequireAddressToken(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.mount()
+	_, token := createTestAddress(t, app, handler, "alice")
+	expired, expiredToken := createTestAddress(t, app, handler, "expired")
+	if err := app.store.Addresses.SetExpiresAt(context.Background(), expired.ID, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("SetExpiresAt failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"no token", "/v1/addresses/alice@example.com", "", http.StatusUnauthorized},
+		{"wrong token", "/v1/addresses/alice@example.com", "Bearer wrong", http.StatusUnauthorized},
+		{"not a bearer token", "/v1/addresses/alice@example.com", token, http.StatusUnauthorized},
+		{"token in the query", "/v1/addresses/alice@example.com?access_token=" + token, "", http.StatusUnauthorized},
+		{"messages without a token", "/v1/messages", "", http.StatusUnauthorized},
+		{"expired address", "/v1/addresses/expired@example.com", "Bearer " + expiredToken, http.StatusGone},
+		{"valid token", "/v1/addresses/alice@example.com", "Bearer " + token, http.StatusOK},
+		{"valid token with another case", "/v1/addresses/Alice@Example.com", "Bearer " + token, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("GET %s returned %d, want %d: %s", tt.path, rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAddressCtxRejectsOtherAddresses(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.mount()
+	createTestAddress(t, app, handler, "alice")
+	_, bobToken := createTestAddress(t, app, handler, "bob")
+
+	for _, path := range []string{"/v1/addresses/alice@example.com", "/v1/addresses/alice@example.com/webhooks"} {
+		if rec := doRequest(t, handler, http.MethodGet, path, bobToken, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("GET %s with another address's token returned %d, want %d", path, rec.Code, http.StatusForbidden)
+		}
+	}
+	if rec := doRequest(t, handler, http.MethodDelete, "/v1/addresses/alice@example.com", bobToken, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("deleting another address returned %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestMessageCtxRejectsOtherAddresses(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.mount()
+	alice, aliceToken := createTestAddress(t, app, handler, "alice")
+	_, bobToken := createTestAddress(t, app, handler, "bob")
+	message := createTestMessage(t, app, alice, "for alice")
+	attachmentID := message.Attachments[0].ID
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"own message", http.MethodGet, fmt.Sprintf("/v1/messages/%d", message.ID), aliceToken, http.StatusOK},
+		{"own attachment", http.MethodGet, fmt.Sprintf("/v1/messages/%d/attachments/%d", message.ID, attachmentID), aliceToken, http.StatusOK},
+		{"another address's message", http.MethodGet, fmt.Sprintf("/v1/messages/%d", message.ID), bobToken, http.StatusForbidden},
+		{"another address's raw message", http.MethodGet, fmt.Sprintf("/v1/messages/%d/raw", message.ID), bobToken, http.StatusForbidden},
+		{"another address's attachments", http.MethodGet, fmt.Sprintf("/v1/messages/%d/attachments", message.ID), bobToken, http.StatusForbidden},
+		{"another address's attachment", http.MethodGet, fmt.Sprintf("/v1/messages/%d/attachments/%d", message.ID, attachmentID), bobToken, http.StatusForbidden},
+		{"deleting another address's message", http.MethodDelete, fmt.Sprintf("/v1/messages/%d", message.ID), bobToken, http.StatusForbidden},
+		{"reading another address's message", http.MethodPut, fmt.Sprintf("/v1/messages/%d/read", message.ID), bobToken, http.StatusForbidden},
+		{"missing message", http.MethodGet, "/v1/messages/999", aliceToken, http.StatusNotFound},
+		{"invalid message ID", http.MethodGet, "/v1/messages/abc", aliceToken, http.StatusBadRequest},
+		{"message without a token", http.MethodGet, fmt.Sprintf("/v1/messages/%d", message.ID), "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := doRequest(t, handler, tt.method, tt.path, tt.token, nil); rec.Code != tt.want {
+				t.Errorf("%s %s returned %d, want %d: %s", tt.method, tt.path, rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
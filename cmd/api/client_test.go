@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+	"github.com/AmoabaKelvin/temp-mail/pkg/client"
+)
+
+// createDetailedMessage stores a message using every field the API returns
+func createDetailedMessage(t *testing.T, app *application, address *store.Address) *store.Message {
+	t.Helper()
+
+	html := `<p>Your code is 123456, or <a href="https://example.com/verify?t=1">verify</a></p>`
+	plain := "Your code is 123456, or verify at https://example.com/verify?t=1"
+	message := &store.Message{
+		FromAddress: "sender@example.com",
+		ToAddressID: uint(address.ID),
+		Subject:     "Verify your email",
+		Snippet:     "Your code is 123456",
+		BodyHTML:    &html,
+		BodyPlain:   &plain,
+		ContentType: "multipart/mixed",
+		Headers:     []byte(`{"Subject":["Verify your email"]}`),
+		MIMETree: &store.MessagePart{ContentType: "multipart/mixed", Size: 100, Parts: []store.MessagePart{
+			{ContentType: "text/plain", Charset: "utf-8", Encoding: "quoted-printable", Size: 60},
+			{ContentType: "image/png", Disposition: "inline", Filename: "logo.png", ContentID: "logo", Encoding: "base64", Size: 4},
+		}},
+		Codes:      []string{"123456"},
+		Links:      []store.MessageLink{{URL: "https://example.com/verify?t=1", Kind: store.LinkVerification, Text: "verify"}},
+		ReceivedAt: time.Now().Add(-time.Minute),
+		Attachments: []store.Attachment{
+			{Filename: "logo.png", ContentType: "image/png", Size: 4, ContentID: "logo", Checksum: "abc", Content: []byte("data")},
+		},
+	}
+	if err := app.store.Messages.Create(context.Background(), message); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	return message
+}
+
+// TestClientTypesMatchResponses decodes real handler responses into the types of pkg/client.
+// Every field the API sends has to be known to the client, and every field of the client has
+// to come back the same when encoded again, so the two can't drift apart.
+func TestClientTypesMatchResponses(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.mount()
+
+	rec := doRequest(t, handler, http.MethodPost, "/v1/addresses", "", createAddressRequest{LocalPart: "alice"})
+	var created client.Address
+	checkClientType(t, "POST /v1/addresses", rec, &created)
+
+	address, err := app.store.Addresses.Get(context.Background(), created.Email)
+	if err != nil {
+		t.Fatalf("failed to get %s: %v", created.Email, err)
+	}
+	message := createDetailedMessage(t, app, address)
+	if err := app.store.Messages.SetReadAt(context.Background(), int64(message.ID), &message.ReceivedAt); err != nil {
+		t.Fatalf("SetReadAt failed: %v", err)
+	}
+	since := time.Now().Add(-time.Hour).Format(time.RFC3339Nano)
+
+	tests := []struct {
+		path string
+		out  any
+	}{
+		{"/v1/addresses/alice@example.com", &client.Address{}},
+		{"/v1/messages?email=alice@example.com", &[]client.MessageSummary{}},
+		{"/v1/messages/search?email=alice@example.com&q=verify", &[]client.MessageSearchResult{}},
+		{fmt.Sprintf("/v1/messages/%d", message.ID), &client.Message{}},
+		{fmt.Sprintf("/v1/messages/%d/attachments", message.ID), &[]client.Attachment{}},
+		{"/v1/messages/wait?email=alice@example.com&since=" + since, &client.Message{}},
+	}
+
+	for _, tt := range tests {
+		rec := doRequest(t, handler, http.MethodGet, tt.path, created.Token, nil)
+		checkClientType(t, "GET "+tt.path, rec, tt.out)
+	}
+}
+
+// checkClientType strictly decodes the data of a response into out and checks that encoding
+// out again gives back the same JSON
+func checkClientType(t *testing.T, request string, rec *httptest.ResponseRecorder, out any) {
+	t.Helper()
+
+	if rec.Code != http.StatusOK && rec.Code != http.StatusCreated {
+		t.Fatalf("%s returned %d: %s", request, rec.Code, rec.Body)
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("%s returned invalid JSON: %v", request, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(envelope.Data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		t.Fatalf("%s doesn't decode into %T: %v", request, out, err)
+	}
+
+	encoded, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("failed to encode %T: %v", out, err)
+	}
+	var sent, roundTripped any
+	json.Unmarshal(envelope.Data, &sent)
+	json.Unmarshal(encoded, &roundTripped)
+	if !reflect.DeepEqual(sent, roundTripped) {
+		t.Errorf("%s returned\n%s\nbut %T encodes as\n%s", request, envelope.Data, out, encoded)
+	}
+}
+
+// TestClientAgainstAPI runs the client against the real handlers
+func TestClientAgainstAPI(t *testing.T) {
+	app := newTestApplication(t)
+	server := httptest.NewServer(app.mount())
+	defer server.Close()
+
+	ctx := context.Background()
+	c := client.New(server.URL)
+	created, err := c.CreateAddress(ctx, client.CreateAddressRequest{LocalPart: "alice", Domain: "example.com"})
+	if err != nil {
+		t.Fatalf("CreateAddress failed: %v", err)
+	}
+	mailbox := c.Mailbox(created.Email, created.Token)
+
+	address, err := app.store.Addresses.Get(ctx, created.Email)
+	if err != nil {
+		t.Fatalf("failed to get %s: %v", created.Email, err)
+	}
+	stored := createDetailedMessage(t, app, address)
+
+	page, err := mailbox.List(ctx, client.ListOptions{Limit: 10})
+	if err != nil || len(page.Messages) != 1 || page.Messages[0].ID != stored.ID || page.NextCursor != "" {
+		t.Fatalf("List = %+v, %v, want the message", page, err)
+	}
+	message, err := mailbox.Message(ctx, stored.ID)
+	if err != nil || len(message.Attachments) != 1 || message.Links[0].Kind != client.LinkVerification {
+		t.Fatalf("Message = %+v, %v", message, err)
+	}
+	content, err := mailbox.DownloadAttachment(ctx, stored.ID, message.Attachments[0].ID)
+	if err != nil || string(content) != "data" {
+		t.Errorf("DownloadAttachment = %q, %v", content, err)
+	}
+
+	if err := mailbox.MarkRead(ctx, stored.ID); err != nil {
+		t.Errorf("MarkRead failed: %v", err)
+	}
+	if err := mailbox.DeleteMessage(ctx, stored.ID); err != nil {
+		t.Errorf("DeleteMessage failed: %v", err)
+	}
+	if _, err := mailbox.Message(ctx, stored.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Message of a deleted message returned %v, want %v", err, client.ErrNotFound)
+	}
+
+	if _, err := mailbox.Wait(ctx, client.WaitOptions{Timeout: 10 * time.Millisecond}); !errors.Is(err, client.ErrNoMessage) {
+		t.Errorf("Wait returned %v, want %v", err, client.ErrNoMessage)
+	}
+}
@@ -13,3 +13,20 @@ func (app *application) serverError(w http.ResponseWriter) {
 func (app *application) badRequest(w http.ResponseWriter, message string) {
 	app.writeErrorJSON(w, http.StatusBadRequest, message)
 }
+
+func (app *application) unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="temp-mail"`)
+	app.writeErrorJSON(w, http.StatusUnauthorized, "missing or invalid access token")
+}
+
+func (app *application) forbidden(w http.ResponseWriter) {
+	app.writeErrorJSON(w, http.StatusForbidden, "you do not have access to this resource")
+}
+
+func (app *application) gone(w http.ResponseWriter, message string) {
+	app.writeErrorJSON(w, http.StatusGone, message)
+}
+
+func (app *application) conflict(w http.ResponseWriter, message string) {
+	app.writeErrorJSON(w, http.StatusConflict, message)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+// sseKeepAliveInterval keeps idle streams from being closed by proxies
+const sseKeepAliveInterval = 25 * time.Second
+
+// loadMessageSummary gets the summary pushed to clients when a message arrives, in the same
+// shape as the list endpoint returns it
+func (app *application) loadMessageSummary(ctx context.Context, messageID int64) (*store.MessageSummary, error) {
+	message, err := app.store.Messages.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := app.store.Attachments.GetByMessageID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.MessageSummary{
+		ID:             message.ID,
+		FromAddress:    message.FromAddress,
+		Subject:        message.Subject,
+		Snippet:        message.Snippet,
+		Codes:          message.Codes,
+		Links:          message.Links,
+		ReceivedAt:     message.ReceivedAt,
+		ReadAt:         message.ReadAt,
+		HasAttachments: len(attachments) > 0,
+	}, nil
+}
+
+// publish announces a change to subscribers of the address. Failures are only logged since
+// the change itself has already been stored.
+func (app *application) publish(r *http.Request, event events.Event) {
+	if err := app.events.Publish(r.Context(), event); err != nil {
+		log.Printf("Failed to publish %s event for message ID %d: %v", event.Type, event.MessageID, err)
+	}
+}
+
+// streamAddressEvents pushes a summary of every new message of an address as Server-Sent Events
+func (app *application) streamAddressEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverError(w)
+		return
+	}
+
+	address := getAddressFromContext(r)
+	subscription := app.events.Subscribe(address.ID)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event := <-subscription.C:
+			if event.Type != events.MessageCreated {
+				continue
+			}
+
+			summary, err := app.loadMessageSummary(r.Context(), event.MessageID)
+			if err != nil {
+				log.Printf("Failed to load message ID %d for event stream: %v", event.MessageID, err)
+				continue
+			}
+
+			data, err := json.Marshal(summary)
+			if err != nil {
+				log.Printf("Failed to encode message ID %d for event stream: %v", event.MessageID, err)
+				continue
+			}
+
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", summary.ID, event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
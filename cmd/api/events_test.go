@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+func TestStreamAddressEventsSendsSummaries(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.mount()
+	address, token := createTestAddress(t, app, handler, "alice")
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// EventSource can't set headers, so the stream takes the token in the query
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/addresses/alice@example.com/events?access_token="+token, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open the stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream returned %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != ": connected" {
+		t.Fatalf("stream started with %q, want the connected comment", lines.Text())
+	}
+
+	message := createTestMessage(t, app, address, "Your code")
+	event := events.Event{Type: events.MessageCreated, AddressID: address.ID, MessageID: int64(message.ID)}
+	if err := app.events.Publish(ctx, event); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	for lines.Scan() {
+		data, ok := strings.CutPrefix(lines.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var summary store.MessageSummary
+		if err := json.Unmarshal([]byte(data), &summary); err != nil {
+			t.Fatalf("failed to decode event %q: %v", data, err)
+		}
+		if summary.ID != message.ID || summary.Snippet != "Your code" || !summary.HasAttachments || summary.ReadAt != nil || summary.Codes == nil || summary.Links == nil {
+			t.Errorf("event = %+v, want the summary of message %d", summary, message.ID)
+		}
+		return
+	}
+	t.Fatalf("stream ended without a message event: %v", lines.Err())
+}
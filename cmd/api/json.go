@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"maps"
 	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
 )
 
 func (app *application) writeJSON(w http.ResponseWriter, status int, data any, headers http.Header) error {
@@ -24,16 +27,20 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data any, h
 	return encoder.Encode(envelope)
 }
 
-// func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data any) error {
-// 	maxBytes := 1_048_576
-// 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data any) error {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
-// 	decoder := json.NewDecoder(r.Body)
-// 	decoder.DisallowUnknownFields()
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
 
-// 	return decoder.Decode(data)
-// }
+	return decoder.Decode(data)
+}
 
 func (app *application) writeErrorJSON(w http.ResponseWriter, status int, message any) error {
 	return app.writeJSON(w, status, map[string]any{"error": message}, nil)
 }
+
+func (app *application) readIDParam(r *http.Request, name string) (int64, error) {
+	return strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+}
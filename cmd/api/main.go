@@ -1,36 +1,161 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AmoabaKelvin/temp-mail/internal/db"
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
+	"github.com/AmoabaKelvin/temp-mail/internal/mailserver"
 	"github.com/AmoabaKelvin/temp-mail/internal/store"
+	"github.com/AmoabaKelvin/temp-mail/internal/store/sqlstore"
+	"github.com/AmoabaKelvin/temp-mail/internal/sweeper"
+	"github.com/AmoabaKelvin/temp-mail/internal/webhook"
 )
 
+// memoryDSN selects the in-memory store instead of a database
+const memoryDSN = "memory:"
+
 func main() {
+	expirationEnabled, _ := strconv.ParseBool(os.Getenv("EXPIRATION_ENABLED"))
+	webhookAllowPrivate, _ := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE"))
+
+	domains := parseDomains(os.Getenv("TEMPMAIL_DOMAINS"))
+	if len(domains) == 0 {
+		log.Fatal("TEMPMAIL_DOMAINS must list at least one domain")
+	}
+
+	sweepInterval := time.Minute
+	if value, ok := os.LookupEnv("SWEEP_INTERVAL"); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			log.Fatalf("Invalid SWEEP_INTERVAL %q", value)
+		}
+		sweepInterval = interval
+	}
+
+	maxTTL := 24 * time.Hour
+	if value, ok := os.LookupEnv("MAX_TTL"); ok {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			log.Fatalf("Invalid MAX_TTL %q", value)
+		}
+		maxTTL = ttl
+	}
+
+	maxLifetime := 7 * 24 * time.Hour
+	if value, ok := os.LookupEnv("MAX_LIFETIME"); ok {
+		lifetime, err := time.ParseDuration(value)
+		if err != nil || lifetime <= 0 {
+			log.Fatalf("Invalid MAX_LIFETIME %q", value)
+		}
+		maxLifetime = lifetime
+	}
+
+	trashGracePeriod := 24 * time.Hour
+	if value, ok := os.LookupEnv("TRASH_GRACE_PERIOD"); ok {
+		period, err := time.ParseDuration(value)
+		if err != nil || period < 0 {
+			log.Fatalf("Invalid TRASH_GRACE_PERIOD %q", value)
+		}
+		trashGracePeriod = period
+	}
+
 	config := &config{
-		addr: os.Getenv("ADDR"),
+		addr:      os.Getenv("ADDR"),
+		debugAddr: os.Getenv("DEBUG_ADDR"),
 		db: &dbConfig{
 			addr: os.Getenv("DATABASE_URL"),
 		},
 		tempMail: &tempMailConfig{
-			domains:           strings.Split(os.Getenv("TEMPMAIL_DOMAINS"), ","),
+			domains:           domains,
 			expireAfter:       os.Getenv("EXPIRE_AFTER"),
-			expirationEnabled: os.Getenv("EXPIRATION_ENABLED"),
+			maxTTL:            maxTTL,
+			maxLifetime:       maxLifetime,
+			expirationEnabled: expirationEnabled,
+			sweepInterval:     sweepInterval,
+			trashGracePeriod:  trashGracePeriod,
 		},
+		webhookAllowPrivate: webhookAllowPrivate,
 	}
 
-	db, err := db.New(config.db.addr)
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+	var storage *store.Storage
+	var bus events.Bus
+	if config.db.addr == memoryDSN {
+		// Nothing survives a restart, which suits demos and integration tests
+		if len(os.Args) > 1 && os.Args[1] == "migrate" {
+			log.Println("The in-memory store has no schema to migrate")
+			return
+		}
+		storage = store.NewMemoryStorage()
+		bus = events.NewLocalBus()
+	} else {
+		db, err := db.New(config.db.addr)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+
+		// `api migrate [up|down|status]` manages the schema and exits
+		if len(os.Args) > 1 && os.Args[1] == "migrate" {
+			command := "up"
+			if len(os.Args) > 2 {
+				command = os.Args[2]
+			}
+			if err := db.RunMigrateCommand(context.Background(), command, os.Stdout); err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			return
+		}
+
+		if autoMigrate, _ := strconv.ParseBool(os.Getenv("AUTO_MIGRATE")); autoMigrate {
+			if err := db.MigrateUp(context.Background()); err != nil {
+				log.Fatalf("Failed to migrate database: %v", err)
+			}
+		}
+
+		storage = sqlstore.NewStorage(db)
+		bus = sqlstore.NewBus(db, config.db.addr)
 	}
 
-	store := store.NewStorage(db)
 	app := &application{
 		config: config,
-		store:  store,
+		store:  storage,
+		events: bus,
+	}
+
+	if postgresBus, ok := bus.(*sqlstore.PostgresBus); ok {
+		go func() {
+			if err := postgresBus.Listen(context.Background()); err != nil {
+				log.Fatalf("Failed to listen for events: %v", err)
+			}
+		}()
+	}
+
+	// With SMTP_PORT set the mail server runs in this process, which is required for live
+	// events with SQLite and for any mail at all with the in-memory store
+	if smtpPort, ok := os.LookupEnv("SMTP_PORT"); ok {
+		go func() {
+			if err := mailserver.Start(storage, bus, smtpPort); err != nil {
+				log.Fatalf("Failed to start mail server: %v", err)
+			}
+		}()
+	}
+
+	go sweeper.New(storage, config.tempMail.sweepInterval, config.tempMail.trashGracePeriod, config.tempMail.expirationEnabled).Run(context.Background())
+
+	go webhook.NewDispatcher(storage, 5*time.Second, config.webhookAllowPrivate).Run(context.Background())
+
+	// Metrics are off unless DEBUG_ADDR is set, e.g. to 127.0.0.1:6060
+	if config.debugAddr != "" {
+		go func() {
+			if err := app.runDebug(); err != nil {
+				log.Fatalf("Failed to start debug server: %v", err)
+			}
+		}()
 	}
 
 	routes := app.mount()
@@ -39,3 +164,15 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// parseDomains splits a comma separated list of domains such as "a.com, b.com", ignoring
+// blank entries
+func parseDomains(value string) []string {
+	domains := []string{}
+	for _, domain := range strings.Split(value, ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseDomains(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"example.com", []string{"example.com"}},
+		{"a.com,b.com", []string{"a.com", "b.com"}},
+		{" a.com , B.com ", []string{"a.com", "b.com"}},
+		{"a.com,,b.com,", []string{"a.com", "b.com"}},
+		{"", []string{}},
+		{" , ", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := parseDomains(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("parseDomains(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
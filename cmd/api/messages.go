@@ -2,14 +2,18 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
 	"github.com/AmoabaKelvin/temp-mail/internal/store"
-	"github.com/go-chi/chi/v5"
 )
 
+// getMessages lists the messages of an address newest first, a page at a time. The cursor
+// of the next page is returned in the X-Next-Cursor header.
 func (app *application) getMessages(w http.ResponseWriter, r *http.Request) {
 	email := r.URL.Query().Get("email")
 
@@ -18,33 +22,56 @@ func (app *application) getMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	address, err := app.store.Addresses.Get(r.Context(), email)
-	if errors.Is(err, store.ErrNotFound) {
-		app.notFound(w)
+	address := getAddressFromContext(r)
+	if !strings.EqualFold(address.Email, email) {
+		app.forbidden(w)
 		return
-	} else if err != nil {
-		app.serverError(w)
+	}
+
+	filter, msg := readMessageFilter(r.URL.Query())
+	if msg != "" {
+		app.badRequest(w, msg)
 		return
 	}
 
-	messages, err := app.store.Messages.Get(r.Context(), address.ID)
+	// Fetch one more than requested to know whether there is a next page
+	pageSize := filter.Limit
+	filter.Limit++
+
+	messages, err := app.store.Messages.List(r.Context(), address.ID, filter)
 	if err != nil {
 		app.serverError(w)
 		return
 	}
 
-	app.writeJSON(w, http.StatusOK, messages, nil)
+	headers := http.Header{}
+	if len(messages) > pageSize {
+		messages = messages[:pageSize]
+		last := messages[len(messages)-1]
+		headers.Set(nextCursorHeader, encodeCursor(last.ReceivedAt, last.ID))
+	}
+
+	app.writeJSON(w, http.StatusOK, messages, headers)
 }
 
-func (app *application) deleteMessage(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+// getMessage returns the full message, including its bodies, headers and attachments
+func (app *application) getMessage(w http.ResponseWriter, r *http.Request) {
+	message := *getMessageFromContext(r)
+
+	attachments, err := app.store.Attachments.GetByMessageID(r.Context(), int64(message.ID))
 	if err != nil {
-		app.badRequest(w, "invalid message ID")
+		app.serverError(w)
 		return
 	}
+	message.Attachments = attachments
+
+	app.writeJSON(w, http.StatusOK, message, nil)
+}
+
+func (app *application) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	message := getMessageFromContext(r)
 
-	if err := app.store.Messages.Delete(r.Context(), id); err != nil {
+	if err := app.store.Messages.Delete(r.Context(), int64(message.ID)); err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.notFound(w)
@@ -54,24 +81,99 @@ func (app *application) deleteMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.publish(r, events.Event{Type: events.MessageDeleted, AddressID: int64(message.ToAddressID), MessageID: int64(message.ID)})
+
 	app.writeJSON(w, http.StatusOK, map[string]string{"message": "Message deleted successfully"}, nil)
 }
 
+// restoreMessage takes a message of the authenticated address back out of the trash
+func (app *application) restoreMessage(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequest(w, "invalid message ID")
+		return
+	}
+
+	address := getAddressFromContext(r)
+	if err := app.store.Messages.Restore(r.Context(), address.ID, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w)
+		default:
+			app.serverError(w)
+		}
+		return
+	}
+
+	app.publish(r, events.Event{Type: events.MessageRestored, AddressID: address.ID, MessageID: id})
+
+	app.writeJSON(w, http.StatusOK, map[string]string{"message": "Message restored successfully"}, nil)
+}
+
 func (app *application) updateMessageReadAt(w http.ResponseWriter, r *http.Request) {
 	readAt := time.Now()
+	message := getMessageFromContext(r)
 
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	err := app.store.Messages.SetReadAt(r.Context(), int64(message.ID), &readAt)
 	if err != nil {
-		app.badRequest(w, "invalid message ID")
+		switch err {
+		case store.ErrNotFound:
+			app.notFound(w)
+		default:
+			app.serverError(w)
+		}
 		return
 	}
 
-	err = app.store.Messages.SetReadAt(r.Context(), id, &readAt)
+	app.publish(r, events.Event{Type: events.MessageRead, AddressID: int64(message.ToAddressID), MessageID: int64(message.ID)})
+
+	app.writeJSON(w, http.StatusOK, map[string]string{"message": "Message read status updated successfully"}, nil)
+}
+
+func (app *application) markMessageUnread(w http.ResponseWriter, r *http.Request) {
+	message := getMessageFromContext(r)
+
+	err := app.store.Messages.SetReadAt(r.Context(), int64(message.ID), nil)
 	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFound(w)
+		default:
+			app.serverError(w)
+		}
+		return
+	}
+
+	app.publish(r, events.Event{Type: events.MessageUnread, AddressID: int64(message.ToAddressID), MessageID: int64(message.ID)})
+
+	app.writeJSON(w, http.StatusOK, map[string]string{"message": "Message marked as unread"}, nil)
+}
+
+func (app *application) downloadRawMessage(w http.ResponseWriter, r *http.Request) {
+	message := getMessageFromContext(r)
+
+	raw, err := app.store.Messages.GetRaw(r.Context(), int64(message.ID))
+	if errors.Is(err, store.ErrNotFound) {
+		app.notFound(w)
+		return
+	} else if err != nil {
 		app.serverError(w)
 		return
 	}
 
-	app.writeJSON(w, http.StatusOK, map[string]string{"message": "Message read status updated successfully"}, nil)
+	w.Header().Set("Content-Type", "message/rfc822")
+	w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="message-%d.eml"`, message.ID))
+	w.WriteHeader(http.StatusOK)
+	w.Write(raw)
+}
+
+// getMessageCodes returns the one-time codes and verification links found in a message
+func (app *application) getMessageCodes(w http.ResponseWriter, r *http.Request) {
+	message := getMessageFromContext(r)
+
+	app.writeJSON(w, http.StatusOK, map[string]any{
+		"codes": message.Codes,
+		"links": message.Links,
+	}, nil)
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+
+	// nextCursorHeader carries the cursor of the next page, it is absent on the last page
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor turns the position of a message into an opaque cursor
+func encodeCursor(receivedAt time.Time, id uint) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d.%d", receivedAt.UnixNano(), id))
+}
+
+func decodeCursor(cursor string) (*store.MessageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var nanos int64
+	var id uint
+	if _, err := fmt.Sscanf(string(b), "%d.%d", &nanos, &id); err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &store.MessageCursor{ReceivedAt: time.Unix(0, nanos), ID: id}, nil
+}
+
+// readMessageFilter parses the pagination and filtering query parameters of the message list,
+// returning a message for the client when one of them is invalid
+func readMessageFilter(query url.Values) (store.MessageFilter, string) {
+	filter := store.MessageFilter{
+		From:    query.Get("from"),
+		Subject: query.Get("subject"),
+		Limit:   defaultPageSize,
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return filter, fmt.Sprintf("limit must be between 1 and %d", maxPageSize)
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			return filter, "cursor is invalid"
+		}
+		filter.Cursor = cursor
+	}
+
+	if value := query.Get("unread"); value != "" {
+		unread, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, "unread must be true or false"
+		}
+		filter.Unread = unread
+	}
+
+	if value := query.Get("has_attachments"); value != "" {
+		hasAttachments, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, "has_attachments must be true or false"
+		}
+		filter.HasAttachments = &hasAttachments
+	}
+
+	if value := query.Get("after"); value != "" {
+		after, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return filter, "after must be an RFC 3339 timestamp"
+		}
+		filter.ReceivedAfter = after
+	}
+
+	if value := query.Get("before"); value != "" {
+		before, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return filter, "before must be an RFC 3339 timestamp"
+		}
+		filter.ReceivedBefore = before
+	}
+
+	return filter, ""
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchMessages runs a full-text search over the subject, sender and bodies of the messages
+// of an address. q supports quoted phrases, OR and -excluded words.
+func (app *application) searchMessages(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	email := query.Get("email")
+
+	if email == "" {
+		app.badRequest(w, "email parameter is required")
+		return
+	}
+
+	address := getAddressFromContext(r)
+	if !strings.EqualFold(address.Email, email) {
+		app.forbidden(w)
+		return
+	}
+
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		app.badRequest(w, "q parameter is required")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			app.badRequest(w, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit))
+			return
+		}
+		limit = parsed
+	}
+
+	results, err := app.store.Messages.Search(r.Context(), address.ID, q, limit)
+	if err != nil {
+		app.serverError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, results, nil)
+}
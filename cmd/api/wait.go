@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 2 * time.Minute
+
+	// waitRecheckInterval is how often the store is checked again while waiting,
+	// in case a notification got lost
+	waitRecheckInterval = 5 * time.Second
+)
+
+// waitForMessage blocks until a message matching the query is received or the timeout
+// passes, in which case it responds with 204 No Content.
+func (app *application) waitForMessage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	email := query.Get("email")
+
+	if email == "" {
+		app.badRequest(w, "email parameter is required")
+		return
+	}
+
+	address := getAddressFromContext(r)
+	if !strings.EqualFold(address.Email, email) {
+		app.forbidden(w)
+		return
+	}
+
+	timeout := defaultWaitTimeout
+	if value := query.Get("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			app.badRequest(w, "timeout must be a positive duration such as 30s")
+			return
+		}
+		timeout = min(parsed, maxWaitTimeout)
+	}
+
+	// Without since only messages received after the request started match
+	filter := store.MessageFilter{
+		ReceivedAfter: time.Now(),
+		From:          query.Get("from"),
+		Subject:       query.Get("subject"),
+		Limit:         1,
+	}
+	if value := query.Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			app.badRequest(w, "since must be an RFC 3339 timestamp")
+			return
+		}
+		filter.ReceivedAfter = since
+	}
+
+	// Subscribe before the first lookup so a message stored in between isn't missed
+	subscription := app.events.Subscribe(address.ID)
+	defer subscription.Close()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	recheck := time.NewTicker(waitRecheckInterval)
+	defer recheck.Stop()
+
+	for {
+		messages, err := app.store.Messages.Find(r.Context(), address.ID, filter)
+		if err != nil {
+			app.serverError(w)
+			return
+		}
+
+		if len(messages) > 0 {
+			app.writeJSON(w, http.StatusOK, messages[0], nil)
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-subscription.C:
+		case <-recheck.C:
+		}
+	}
+}
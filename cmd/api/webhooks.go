@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+	"github.com/AmoabaKelvin/temp-mail/internal/webhook"
+)
+
+const (
+	maxWebhooksPerAddress = 10
+	webhookAttemptsLimit  = 50
+)
+
+func (app *application) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL string `json:"url"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, "invalid request body: "+err.Error())
+		return
+	}
+
+	target, err := url.ParseRequestURI(input.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		app.badRequest(w, "url must be an absolute http or https URL")
+		return
+	}
+	if !app.config.webhookAllowPrivate {
+		if err := webhook.CheckHost(r.Context(), target.Hostname()); errors.Is(err, webhook.ErrForbiddenAddress) {
+			app.badRequest(w, "url must point to a public address")
+			return
+		} else if err != nil {
+			app.badRequest(w, "url host could not be resolved")
+			return
+		}
+	}
+
+	address := getAddressFromContext(r)
+	webhooks, err := app.store.Webhooks.GetByAddress(r.Context(), address.ID)
+	if err != nil {
+		app.serverError(w)
+		return
+	}
+	if len(webhooks) >= maxWebhooksPerAddress {
+		app.badRequest(w, "too many webhooks for this address")
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		app.serverError(w)
+		return
+	}
+
+	webhook := store.Webhook{
+		AddressID: address.ID,
+		URL:       target.String(),
+		Secret:    hex.EncodeToString(secret),
+	}
+	if err := app.store.Webhooks.Create(r.Context(), &webhook); err != nil {
+		app.serverError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, webhook, nil)
+}
+
+func (app *application) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := app.store.Webhooks.GetByAddress(r.Context(), getAddressFromContext(r).ID)
+	if err != nil {
+		app.serverError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, webhooks, nil)
+}
+
+func (app *application) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := app.readIDParam(r, "webhookID")
+	if err != nil {
+		app.badRequest(w, "invalid webhook ID")
+		return
+	}
+
+	err = app.store.Webhooks.Delete(r.Context(), getAddressFromContext(r).ID, webhookID)
+	if errors.Is(err, store.ErrNotFound) {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted successfully"}, nil)
+}
+
+// getWebhookAttempts returns the delivery attempt log of a webhook
+func (app *application) getWebhookAttempts(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := app.readIDParam(r, "webhookID")
+	if err != nil {
+		app.badRequest(w, "invalid webhook ID")
+		return
+	}
+
+	webhooks, err := app.store.Webhooks.GetByAddress(r.Context(), getAddressFromContext(r).ID)
+	if err != nil {
+		app.serverError(w)
+		return
+	}
+
+	found := false
+	for _, webhook := range webhooks {
+		if webhook.ID == webhookID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		app.notFound(w)
+		return
+	}
+
+	attempts, err := app.store.Webhooks.GetAttempts(r.Context(), webhookID, webhookAttemptsLimit)
+	if err != nil {
+		app.serverError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, attempts, nil)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCreateWebhookPrivateTargets(t *testing.T) {
+	body := map[string]string{"url": "http://127.0.0.1:8080/hook"}
+
+	app := newTestApplication(t)
+	handler := app.mount()
+	_, token := createTestAddress(t, app, handler, "alice")
+	if rec := doRequest(t, handler, http.MethodPost, "/v1/addresses/alice@example.com/webhooks", token, body); rec.Code != http.StatusBadRequest {
+		t.Errorf("creating a loopback webhook returned %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	app.config.webhookAllowPrivate = true
+	if rec := doRequest(t, handler, http.MethodPost, "/v1/addresses/alice@example.com/webhooks", token, body); rec.Code != http.StatusCreated {
+		t.Errorf("creating a loopback webhook with private targets allowed returned %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+const (
+	maxWebSocketSubscriptions = 20
+	webSocketWriteTimeout     = 10 * time.Second
+)
+
+// wsRequest is sent by clients to manage their subscriptions. Every address is
+// authenticated with its own access token.
+type wsRequest struct {
+	Type  string `json:"type"` // "subscribe" or "unsubscribe"
+	Email string `json:"email"`
+	Token string `json:"token,omitempty"`
+}
+
+// wsMessage is sent to clients, either in reply to a request or for an event
+type wsMessage struct {
+	Type      string                `json:"type"`
+	Email     string                `json:"email,omitempty"`
+	MessageID int64                 `json:"message_id,omitempty"`
+	Message   *store.MessageSummary `json:"message,omitempty"`
+	Error     string                `json:"error,omitempty"`
+}
+
+// inboxWebSocket lets a client subscribe to several addresses and receive their
+// message.created, message.read, message.unread, message.deleted and message.restored events
+func (app *application) inboxWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: webSocketOriginPatterns()})
+	if err != nil {
+		log.Printf("Failed to accept WebSocket connection: %v", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	ctx := r.Context()
+	subscriptions := map[string]*events.Subscription{}
+	defer func() {
+		for _, subscription := range subscriptions {
+			subscription.Close()
+		}
+	}()
+
+	for {
+		var request wsRequest
+		if err := wsjson.Read(ctx, conn, &request); err != nil {
+			if status := websocket.CloseStatus(err); status != websocket.StatusNormalClosure && status != websocket.StatusGoingAway {
+				log.Printf("Closing WebSocket connection: %v", err)
+			}
+			return
+		}
+
+		key := strings.ToLower(request.Email)
+		switch request.Type {
+		case "subscribe":
+			if _, ok := subscriptions[key]; ok {
+				writeWebSocket(ctx, conn, wsMessage{Type: "subscribed", Email: request.Email})
+				continue
+			}
+			if len(subscriptions) >= maxWebSocketSubscriptions {
+				writeWebSocket(ctx, conn, wsMessage{Type: "error", Email: request.Email, Error: "too many subscriptions"})
+				continue
+			}
+
+			address, err := app.store.Addresses.GetByTokenHash(ctx, hashToken(request.Token))
+			if errors.Is(err, store.ErrNotFound) || (err == nil && !strings.EqualFold(address.Email, request.Email)) {
+				writeWebSocket(ctx, conn, wsMessage{Type: "error", Email: request.Email, Error: "missing or invalid access token"})
+				continue
+			} else if errors.Is(err, store.ErrExpired) {
+				writeWebSocket(ctx, conn, wsMessage{Type: "error", Email: request.Email, Error: "address has expired"})
+				continue
+			} else if err != nil {
+				writeWebSocket(ctx, conn, wsMessage{Type: "error", Email: request.Email, Error: "internal server error"})
+				continue
+			}
+
+			subscription := app.events.Subscribe(address.ID)
+			subscriptions[key] = subscription
+			go app.forwardWebSocketEvents(ctx, conn, address.Email, subscription)
+
+			writeWebSocket(ctx, conn, wsMessage{Type: "subscribed", Email: address.Email})
+		case "unsubscribe":
+			if subscription, ok := subscriptions[key]; ok {
+				subscription.Close()
+				delete(subscriptions, key)
+			}
+			writeWebSocket(ctx, conn, wsMessage{Type: "unsubscribed", Email: request.Email})
+		default:
+			writeWebSocket(ctx, conn, wsMessage{Type: "error", Error: "unknown request type"})
+		}
+	}
+}
+
+// forwardWebSocketEvents sends the events of one address until it is unsubscribed
+func (app *application) forwardWebSocketEvents(ctx context.Context, conn *websocket.Conn, email string, subscription *events.Subscription) {
+	for event := range subscription.C {
+		message := wsMessage{Type: string(event.Type), Email: email, MessageID: event.MessageID}
+
+		if event.Type == events.MessageCreated {
+			summary, err := app.loadMessageSummary(ctx, event.MessageID)
+			if err != nil {
+				log.Printf("Failed to load message ID %d for WebSocket: %v", event.MessageID, err)
+				continue
+			}
+			message.Message = summary
+		}
+
+		if err := writeWebSocket(ctx, conn, message); err != nil {
+			return
+		}
+	}
+}
+
+func writeWebSocket(ctx context.Context, conn *websocket.Conn, message wsMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, webSocketWriteTimeout)
+	defer cancel()
+
+	return wsjson.Write(ctx, conn, message)
+}
+
+// webSocketOriginPatterns allows the same browser origins as CORS
+func webSocketOriginPatterns() []string {
+	patterns := make([]string, 0, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if u, err := url.Parse(origin); err == nil && u.Host != "" {
+			patterns = append(patterns, u.Host)
+		}
+	}
+	return patterns
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strconv"
 
+	"github.com/AmoabaKelvin/temp-mail/internal/db"
 	"github.com/AmoabaKelvin/temp-mail/internal/mailserver"
+	"github.com/AmoabaKelvin/temp-mail/internal/store/sqlstore"
 )
 
 func main() {
@@ -12,12 +16,53 @@ func main() {
 	if !ok {
 		log.Fatalf("DATABASE_URL is not set")
 	}
+
+	database, err := db.New(databaseUrl)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	// `server migrate [up|down|status]` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		command := "up"
+		if len(os.Args) > 2 {
+			command = os.Args[2]
+		}
+		if err := database.RunMigrateCommand(context.Background(), command, os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	if autoMigrate, _ := strconv.ParseBool(os.Getenv("AUTO_MIGRATE")); autoMigrate {
+		if err := database.MigrateUp(context.Background()); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
+
 	smtpPort, ok := os.LookupEnv("SMTP_PORT")
 	if !ok {
 		log.Fatalf("SMTP_PORT is not set")
 	}
 
-	if err := mailserver.Start(databaseUrl, smtpPort); err != nil {
+	if database.Driver == db.DriverSQLite {
+		log.Println("Events can't reach the API from a separate process with SQLite, set SMTP_PORT on the API to run the mail server there instead")
+	}
+
+	publisher := sqlstore.NewBus(database, databaseUrl)
+	storage := sqlstore.NewStorage(database)
+
+	// LMTP_PORT additionally serves LMTP for a relay in front of the server, which gets a
+	// separate reply for every recipient
+	if lmtpPort, ok := os.LookupEnv("LMTP_PORT"); ok {
+		go func() {
+			if err := mailserver.StartLMTP(storage, publisher, lmtpPort); err != nil {
+				log.Fatalf("Failed to start LMTP server: %v", err)
+			}
+		}()
+	}
+
+	if err := mailserver.Start(storage, publisher, smtpPort); err != nil {
 		log.Fatalf("Failed to start mail server: %v", err)
 	}
 }
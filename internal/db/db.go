@@ -4,32 +4,66 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
 )
 
+// Drivers New can connect with, chosen by the scheme of the DSN
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 type DB struct {
 	*sql.DB
+	Driver string
 }
 
+// New connects to the database in dsn. DSNs starting with sqlite: open a SQLite database
+// file, e.g. sqlite:///var/lib/temp-mail/mail.db or sqlite://mail.db, everything else is
+// passed to the Postgres driver.
 func New(dsn string) (*DB, error) {
-	db, err := sql.Open("postgres", dsn)
-	if err != nil {
-		return nil, err
+	driver := DriverPostgres
+	var db *sql.DB
+	if path, ok := sqlitePath(dsn); ok {
+		driver = DriverSQLite
+		db = openSQLite(path)
+	} else {
+		var err error
+		if db, err = sql.Open("postgres", dsn); err != nil {
+			return nil, err
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err = db.PingContext(ctx); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		return nil, err
 	}
 
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxIdleTime(5 * time.Minute)
+	if driver == DriverSQLite {
+		// SQLite has a single writer, sharing one connection avoids "database is locked"
+		// errors and keeps in-memory databases alive
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+	} else {
+		db.SetMaxOpenConns(10)
+		db.SetMaxIdleConns(5)
+		db.SetConnMaxIdleTime(5 * time.Minute)
+	}
 
 	log.Println("Connected to the database successfully")
-	return &DB{db}, nil
+	return &DB{DB: db, Driver: driver}, nil
+}
+
+// sqlitePath returns the file path of a sqlite: DSN
+func sqlitePath(dsn string) (string, bool) {
+	path, ok := strings.CutPrefix(dsn, "sqlite:")
+	if !ok {
+		return "", false
+	}
+	return strings.TrimPrefix(path, "//"), true
 }
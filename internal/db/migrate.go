@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// SQLite has its own schema in migrations/sqlite, which has to be kept in line with the
+// Postgres migrations
+//
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var migrations embed.FS
+
+// newMigrationProvider returns a goose provider over the embedded migrations. Postgres
+// migrations are serialised with an advisory lock so several processes can migrate on startup.
+func newMigrationProvider(db *DB) (*goose.Provider, error) {
+	if db.Driver == DriverSQLite {
+		fsys, err := fs.Sub(migrations, "migrations/sqlite")
+		if err != nil {
+			return nil, err
+		}
+		return goose.NewProvider(goose.DialectSQLite3, db.DB, fsys)
+	}
+
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+
+	return goose.NewProvider(goose.DialectPostgres, db.DB, fsys, goose.WithSessionLocker(locker))
+}
+
+// MigrateUp applies every pending migration
+func (db *DB) MigrateUp(ctx context.Context) error {
+	provider, err := newMigrationProvider(db)
+	if err != nil {
+		return err
+	}
+
+	results, err := provider.Up(ctx)
+	for _, result := range results {
+		log.Println(result)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	version, err := provider.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Database schema is at version %d", version)
+	return nil
+}
+
+// MigrateDown rolls back the most recently applied migration
+func (db *DB) MigrateDown(ctx context.Context) error {
+	provider, err := newMigrationProvider(db)
+	if err != nil {
+		return err
+	}
+
+	result, err := provider.Down(ctx)
+	if result != nil {
+		log.Println(result)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to roll back migration: %w", err)
+	}
+	return nil
+}
+
+// MigrationStatus writes the state of every known migration to w
+func (db *DB) MigrationStatus(ctx context.Context, w io.Writer) error {
+	provider, err := newMigrationProvider(db)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get migration status: %w", err)
+	}
+
+	for _, status := range statuses {
+		appliedAt := "Pending"
+		if status.State == goose.StateApplied {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%-20s %s\n", appliedAt, status.Source.Path)
+	}
+	return nil
+}
+
+// RunMigrateCommand runs a migrate subcommand: "up", "down" or "status"
+func (db *DB) RunMigrateCommand(ctx context.Context, command string, w io.Writer) error {
+	switch command {
+	case "up":
+		return db.MigrateUp(ctx)
+	case "down":
+		return db.MigrateDown(ctx)
+	case "status":
+		return db.MigrationStatus(ctx, w)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+}
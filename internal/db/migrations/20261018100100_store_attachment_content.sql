@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE attachments
+    DROP COLUMN IF EXISTS file_location,
+    ALTER COLUMN filename TYPE TEXT,
+    ALTER COLUMN content_type TYPE TEXT,
+    ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS content_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS checksum varchar(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS content BYTEA NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE attachments
+    DROP COLUMN IF EXISTS content,
+    DROP COLUMN IF EXISTS checksum,
+    DROP COLUMN IF EXISTS content_id,
+    DROP COLUMN IF EXISTS size,
+    ALTER COLUMN content_type TYPE varchar(255),
+    ALTER COLUMN filename TYPE varchar(255),
+    ADD COLUMN IF NOT EXISTS file_location TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS token_hash BYTEA;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_token_hash ON addresses (token_hash);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_addresses_token_hash;
+
+ALTER TABLE addresses DROP COLUMN IF EXISTS token_hash;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS snippet TEXT NOT NULL DEFAULT '';
+
+UPDATE messages
+SET snippet = left(btrim(regexp_replace(
+    COALESCE(body_plain, regexp_replace(body_html, '<[^>]*>', ' ', 'g'), ''),
+    '\s+', ' ', 'g'
+)), 200);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages DROP COLUMN IF EXISTS snippet;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(subject, '')), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(from_address, '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE(body_plain, '')), 'C') ||
+    -- the first quantifier is lazy so that postgres matches the whole expression lazily
+    setweight(to_tsvector('english', regexp_replace(
+        regexp_replace(COALESCE(body_html, ''), '<(style|script)[^>]*?>.*?</\1>', ' ', 'gi'),
+        '<[^>]*>', ' ', 'g'
+    )), 'D')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_messages_search_vector ON messages USING GIN (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_messages_search_vector;
+ALTER TABLE messages DROP COLUMN IF EXISTS search_vector;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Recipients are looked up in lower case. Addresses differing only by case are merged into
+-- the one expiring last: the messages and webhooks of the others move to it and their tokens
+-- stop working.
+CREATE TEMPORARY TABLE address_merges AS
+SELECT id, keep_id FROM (
+    SELECT id, first_value(id) OVER (PARTITION BY lower(email) ORDER BY expires_at DESC, id) AS keep_id
+    FROM addresses
+) ranked
+WHERE id <> keep_id;
+
+UPDATE messages SET to_address_id = (SELECT keep_id FROM address_merges WHERE id = messages.to_address_id)
+WHERE to_address_id IN (SELECT id FROM address_merges);
+
+UPDATE webhooks SET address_id = (SELECT keep_id FROM address_merges WHERE id = webhooks.address_id)
+WHERE address_id IN (SELECT id FROM address_merges);
+
+DELETE FROM addresses WHERE id IN (SELECT id FROM address_merges);
+
+DROP TABLE address_merges;
+
+UPDATE addresses SET email = lower(email) WHERE email <> lower(email);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 1;
+-- +goose StatementEnd
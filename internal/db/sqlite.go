@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteTimeFormat is how times are stored in SQLite. Times are always written in UTC in this
+// format so that they can be compared as text.
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// sqliteParams enable foreign keys and WAL mode, wait for locks instead of failing and store
+// times in sqliteTimeFormat
+const sqliteParams = "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+
+var (
+	sqliteStyleBlock = regexp.MustCompile(`(?is)<(style|script)\b.*?</(style|script)>`)
+	sqliteTag        = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// The Postgres functions used by the stores, plus strip_tags for the full-text search triggers
+func init() {
+	sqlite.MustRegisterScalarFunction("now", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format(sqliteTimeFormat), nil
+	})
+
+	sqlite.MustRegisterDeterministicScalarFunction("strpos", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		s, ok1 := args[0].(string)
+		substr, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, nil
+		}
+		return int64(strings.Index(s, substr) + 1), nil
+	})
+
+	sqlite.MustRegisterDeterministicScalarFunction("strip_tags", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		html, ok := args[0].(string)
+		if !ok {
+			return "", nil
+		}
+		return sqliteTag.ReplaceAllString(sqliteStyleBlock.ReplaceAllString(html, " "), " "), nil
+	})
+}
+
+func openSQLite(path string) *sql.DB {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return sql.OpenDB(&sqliteConnector{dsn: path + separator + sqliteParams, driver: registeredSQLiteDriver()})
+}
+
+// registeredSQLiteDriver returns the driver registered as "sqlite", which is the one holding
+// the functions registered in init
+func registeredSQLiteDriver() *sqlite.Driver {
+	db, _ := sql.Open("sqlite", "")
+	defer db.Close()
+	return db.Driver().(*sqlite.Driver)
+}
+
+// sqliteConnector opens connections that convert every time argument to UTC
+type sqliteConnector struct {
+	dsn    string
+	driver *sqlite.Driver
+}
+
+func (c *sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return utcConn{conn.(sqliteConn)}, nil
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// sqliteConn is the set of driver interfaces implemented by SQLite connections
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type utcConn struct {
+	sqliteConn
+}
+
+// CheckNamedValue converts times to UTC and leaves the rest to the default conversion
+func (utcConn) CheckNamedValue(value *driver.NamedValue) error {
+	switch t := value.Value.(type) {
+	case time.Time:
+		value.Value = t.UTC()
+	case *time.Time:
+		if t != nil {
+			value.Value = t.UTC()
+		}
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+type Type string
+
+const (
+	MessageCreated  Type = "message.created"
+	MessageRead     Type = "message.read"
+	MessageUnread   Type = "message.unread"
+	MessageDeleted  Type = "message.deleted"
+	MessageRestored Type = "message.restored"
+)
+
+// Event describes a change to the messages of an address. MessageID is zero when the
+// change applies to every message of the address, like marking the whole inbox read.
+type Event struct {
+	Type      Type  `json:"type"`
+	AddressID int64 `json:"address_id"`
+	MessageID int64 `json:"message_id"`
+}
+
+// Publisher sends events to every interested subscriber
+type Publisher interface {
+	Publish(context.Context, Event) error
+}
+
+// Bus is a Publisher that can also be subscribed to
+type Bus interface {
+	Publisher
+	Subscribe(addressID int64) *Subscription
+}
+
+// subscriptionBuffer is the number of events a subscriber can fall behind before
+// further events are dropped for it
+const subscriptionBuffer = 64
+
+// Subscription receives the events of a single address on C until it is closed
+type Subscription struct {
+	C <-chan Event
+
+	c         chan Event
+	addressID int64
+	bus       *LocalBus
+}
+
+// Close stops the subscription and releases its resources
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// LocalBus fans events out to subscribers in the same process
+type LocalBus struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[*Subscription]struct{}
+}
+
+func NewLocalBus() *LocalBus {
+	return &LocalBus{subscribers: make(map[int64]map[*Subscription]struct{})}
+}
+
+func (b *LocalBus) Publish(_ context.Context, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers[event.AddressID] {
+		select {
+		case sub.c <- event:
+		default:
+			log.Printf("Dropping %s event for slow subscriber of address %d", event.Type, event.AddressID)
+		}
+	}
+	return nil
+}
+
+func (b *LocalBus) Subscribe(addressID int64) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, addressID: addressID, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[addressID] == nil {
+		b.subscribers[addressID] = make(map[*Subscription]struct{})
+	}
+	b.subscribers[addressID][sub] = struct{}{}
+	return sub
+}
+
+func (b *LocalBus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := b.subscribers[sub.addressID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subscribers, sub.addressID)
+	}
+	close(sub.c)
+}
@@ -0,0 +1,104 @@
+package mailserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// headerGetter is satisfied by both mail.Header and textproto.MIMEHeader.
+type headerGetter interface {
+	Get(key string) string
+}
+
+// wordDecoder decodes RFC 2047 encoded-words such as "=?ISO-8859-1?Q?caf=E9?=".
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// charsetReader returns a reader that converts text in the given charset to UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q: %w", charset, err)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// decodeHeader decodes any encoded-words in a header value, falling back to the raw value.
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		log.Printf("Failed to decode header value '%s': %v", value, err)
+		return value
+	}
+	return decoded
+}
+
+// decodeTransferEncoding undoes the Content-Transfer-Encoding of a part body.
+// Unknown encodings and undecodable bodies are returned unchanged.
+func decodeTransferEncoding(body []byte, encoding string) []byte {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// Line breaks are allowed anywhere in the encoded data and some senders drop the padding.
+		cleaned := bytes.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, body)
+		cleaned = bytes.TrimRight(cleaned, "=")
+
+		decoded := make([]byte, base64.RawStdEncoding.DecodedLen(len(cleaned)))
+		n, err := base64.RawStdEncoding.Decode(decoded, cleaned)
+		if err != nil {
+			log.Printf("Failed to decode base64 body: %v. Keeping raw body.", err)
+			return body
+		}
+		return decoded[:n]
+	case "quoted-printable":
+		decoded, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+		if err != nil {
+			log.Printf("Failed to decode quoted-printable body: %v. Keeping raw body.", err)
+			return body
+		}
+		return decoded
+	default:
+		// 7bit, 8bit and binary bodies are stored as-is
+		return body
+	}
+}
+
+// decodeCharset converts text in the given charset to UTF-8. Text without a charset is
+// assumed to be UTF-8 already, and text in an unknown charset has its invalid bytes replaced.
+func decodeCharset(body []byte, charset string) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "utf8" || charset == "us-ascii" {
+		return strings.ToValidUTF8(string(body), string(utf8.RuneError))
+	}
+
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		log.Printf("Unsupported charset '%s': %v. Treating body as UTF-8.", charset, err)
+		return strings.ToValidUTF8(string(body), string(utf8.RuneError))
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		log.Printf("Failed to decode body from charset '%s': %v. Treating body as UTF-8.", charset, err)
+		return strings.ToValidUTF8(string(body), string(utf8.RuneError))
+	}
+	return string(decoded)
+}
+
+// decodeTextBody decodes a text part body using the transfer encoding and charset from its header.
+func decodeTextBody(body []byte, header headerGetter, params map[string]string) string {
+	decoded := decodeTransferEncoding(body, header.Get("Content-Transfer-Encoding"))
+	return decodeCharset(decoded, params["charset"])
+}
@@ -0,0 +1,212 @@
+package mailserver
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+const (
+	maxExtractedCodes = 5
+	maxExtractedLinks = 10
+
+	// codeKeywordWindow is how far after a keyword such as "code" a candidate may appear
+	codeKeywordWindow = 80
+	// codeKeywordLookbehind is how far before a keyword a candidate may appear, as in
+	// "123456 is your code", when there is none after it
+	codeKeywordLookbehind = 40
+)
+
+var (
+	// "confirm" is left out, it is as likely to be about an order number as about a code
+	codeKeywordPattern = regexp.MustCompile(`(?i)\b(code|otp|passcode|pin|one[- ]time|verification|verify|security|login|log[- ]in|sign[- ]?in|2fa|token)\b`)
+	numericCodePattern = regexp.MustCompile(`\b\d{4,8}\b|\b\d{3}[- ]\d{3}\b`)
+	alnumCodePattern   = regexp.MustCompile(`\b[A-Z0-9]{6,10}\b|\b[A-Z0-9]{3,5}-[A-Z0-9]{3,5}\b`)
+
+	sentenceEndPattern = regexp.MustCompile(`[.!?](\s|$)`)
+
+	anchorPattern     = regexp.MustCompile(`(?is)<a\b[^>]*?href\s*=\s*["']([^"']+)["'][^>]*>(.*?)</a>`)
+	urlPattern        = regexp.MustCompile(`https?://[^\s<>"'()\[\]]+`)
+	blockPattern      = regexp.MustCompile(`(?is)<(style|script|head)\b.*?</(style|script|head)>`)
+	tagPattern        = regexp.MustCompile(`(?s)<[^>]*>`)
+	whitespacePattern = regexp.MustCompile(`[ \t\r\f\v]+`)
+)
+
+// linkKinds maps keywords found in a link's URL or text to the kind of link, in order of
+// precedence. Keywords only match whole words or path segments, so /author isn't /auth.
+var linkKinds = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{store.LinkPasswordReset, linkKeywordPattern(`reset[-_]?password`, `password[-_]?reset`, `reset`, `passwords?`, `recover(y)?`, `forgot`)},
+	{store.LinkMagicLink, linkKeywordPattern(`magic[-_]?link`, `magic`, `log[-_ ]?in`, `sign[-_ ]?in`, `auth`, `authenticate`)},
+	{store.LinkVerification, linkKeywordPattern(`verify`, `verification`, `confirm(ation)?`, `activate`, `activation`, `validate`, `validation`, `invite`, `invitation`)},
+}
+
+// linkKeywordPattern matches any of keywords when not surrounded by other letters
+func linkKeywordPattern(keywords ...string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|[^a-z])(` + strings.Join(keywords, "|") + `)([^a-z]|$)`)
+}
+
+// extractCodes finds one-time codes in the subject and body of a message. A candidate only
+// counts when it is the first one following a keyword such as "code" or "verification" in
+// the same sentence, or failing that the last one shortly before it. This keeps order
+// numbers, dates and prices out.
+func extractCodes(subject, text string) []string {
+	codes := []string{}
+	seen := map[string]bool{}
+
+	for _, source := range []string{subject, text} {
+		for _, keyword := range codeKeywordPattern.FindAllStringIndex(source, -1) {
+			after := source[keyword[1]:min(keyword[1]+codeKeywordWindow, len(source))]
+			if i := sentenceEndPattern.FindStringIndex(after); i != nil {
+				after = after[:i[0]]
+			}
+
+			start := max(keyword[0]-codeKeywordLookbehind, 0)
+			before := source[start:keyword[0]]
+			if start > 0 {
+				// Don't start in the middle of a word or number
+				_, before, _ = strings.Cut(before, " ")
+			}
+			if ends := sentenceEndPattern.FindAllStringIndex(before, -1); ends != nil {
+				before = before[ends[len(ends)-1][1]:]
+			}
+
+			candidate := ""
+			if candidates := findCodes(after); len(candidates) > 0 {
+				candidate = candidates[0]
+			} else if candidates := findCodes(before); len(candidates) > 0 {
+				candidate = candidates[len(candidates)-1]
+			}
+			if candidate == "" || seen[candidate] || len(codes) >= maxExtractedCodes {
+				continue
+			}
+			seen[candidate] = true
+			codes = append(codes, candidate)
+		}
+	}
+
+	return codes
+}
+
+// findCodes returns the numeric and alphanumeric codes in text in the order they appear
+func findCodes(text string) []string {
+	var spans [][]int
+	for _, i := range numericCodePattern.FindAllStringIndex(text, -1) {
+		if !isPartOfNumber(text, i[0], i[1]) {
+			spans = append(spans, i)
+		}
+	}
+	for _, i := range alnumCodePattern.FindAllStringIndex(text, -1) {
+		if isAlphanumericCode(text[i[0]:i[1]]) {
+			spans = append(spans, i)
+		}
+	}
+	slices.SortFunc(spans, func(a, b []int) int { return a[0] - b[0] })
+
+	codes := make([]string, 0, len(spans))
+	for _, i := range spans {
+		codes = append(codes, text[i[0]:i[1]])
+	}
+	return codes
+}
+
+// isPartOfNumber reports whether the digits in text[start:end] belong to something larger,
+// such as a date, time, phone number, price or order number like #12345
+func isPartOfNumber(text string, start, end int) bool {
+	if start > 0 && strings.ContainsAny(text[start-1:start], "#$€£") {
+		return true
+	}
+	if start > 1 && strings.ContainsAny(text[start-1:start], "-/.:,") && isDigit(text[start-2]) {
+		return true
+	}
+	if end+1 < len(text) && strings.ContainsAny(text[end:end+1], "-/.:,") && isDigit(text[end+1]) {
+		return true
+	}
+	return false
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// isAlphanumericCode rejects all-letter words like "ACCOUNT", which the pattern also matches
+func isAlphanumericCode(candidate string) bool {
+	hasDigit, hasLetter := false, false
+	for _, r := range candidate {
+		switch {
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsLetter(r):
+			hasLetter = true
+		}
+	}
+	return hasDigit && hasLetter
+}
+
+// extractLinks finds verification, password reset and magic links in the html and plain bodies
+func extractLinks(htmlBody, plainBody string) []store.MessageLink {
+	links := []store.MessageLink{}
+	seen := map[string]bool{}
+
+	add := func(rawURL, text string) {
+		rawURL = strings.TrimRight(html.UnescapeString(strings.TrimSpace(rawURL)), ".,;:!?")
+		if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+			return
+		}
+		if seen[rawURL] || len(links) >= maxExtractedLinks {
+			return
+		}
+
+		kind := classifyLink(rawURL, text)
+		if kind == "" {
+			return
+		}
+
+		seen[rawURL] = true
+		links = append(links, store.MessageLink{URL: rawURL, Kind: kind, Text: text})
+	}
+
+	for _, match := range anchorPattern.FindAllStringSubmatch(htmlBody, -1) {
+		add(match[1], htmlToText(match[2]))
+	}
+	for _, match := range urlPattern.FindAllString(plainBody, -1) {
+		add(match, "")
+	}
+
+	return links
+}
+
+func classifyLink(rawURL, text string) string {
+	haystack := strings.ToLower(rawURL + " " + text)
+	for _, linkKind := range linkKinds {
+		if linkKind.pattern.MatchString(haystack) {
+			return linkKind.kind
+		}
+	}
+	return ""
+}
+
+// htmlToText strips tags, styles and scripts from an html body and unescapes entities
+func htmlToText(body string) string {
+	text := blockPattern.ReplaceAllString(body, " ")
+	text = tagPattern.ReplaceAllString(text, " ")
+	text = html.UnescapeString(text)
+	text = whitespacePattern.ReplaceAllString(text, " ")
+	return strings.TrimSpace(text)
+}
+
+// extractCodesAndLinks runs every extractor over a parsed message
+func extractCodesAndLinks(subject string, body *parsedBody) ([]string, []store.MessageLink) {
+	text := body.Plain
+	if text == "" {
+		text = htmlToText(body.HTML)
+	}
+
+	return extractCodes(subject, text), extractLinks(body.HTML, body.Plain)
+}
@@ -0,0 +1,108 @@
+package mailserver
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+func TestExtractCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		text    string
+		want    []string
+	}{
+		{"code after keyword", "", "Your verification code is 482913.", []string{"482913"}},
+		{"code in subject", "Your login code: 7731", "", []string{"7731"}},
+		{"code before keyword", "", "Use 123-456 as your login code.", []string{"123-456"}},
+		{"code leading the subject", "905112 is your Slack code", "", []string{"905112"}},
+		{"alphanumeric code", "", "Enter the code A7K2Q9 to continue", []string{"A7K2Q9"}},
+		{"alphanumeric code with dash", "", "Your sign-in code: X4F-9QZ", []string{"X4F-9QZ"}},
+		{"all-letter word is not a code", "", "Your code for ACCOUNT access is 5521", []string{"5521"}},
+		{"subject and body are deduplicated", "Code 1234", "Your code is 1234", []string{"1234"}},
+		{"order confirmation", "", "Please confirm your order 55512345 by Friday.", []string{}},
+		{"order number before a keyword in the next sentence", "", "Order 55512345 shipped. Your security settings are unchanged.", []string{}},
+		{"code only in a later sentence", "", "Use the code below. It expires soon. 123456", []string{}},
+		{"keyword too far from the code", "", "Your code is in the attachment, which we sent along with a summary of everything that happened to your account this week: 123456", []string{}},
+		{"date after keyword", "", "Login on 2026-10-18 from a new device", []string{}},
+		{"time after keyword", "", "Sign in at 10:45 from Chrome", []string{}},
+		{"price after keyword", "", "Security deposit of $1500 is due", []string{}},
+		{"order number after keyword", "", "Verification of order #123456 complete", []string{}},
+		{"phone number after keyword", "", "Questions about your PIN? Call 555-123-4567", []string{}},
+		{"no keyword", "", "Invoice 20261018 for 4500 units", []string{}},
+		{"keyword inside a word", "", "Codex build 123456", []string{}},
+		{"code before keyword after a long prefix", "", "Hi there, thanks for signing up to our service 99123456 is your code", []string{"99123456"}},
+		{"lookbehind does not start mid number", "", "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx 123456789012 is your pin", []string{}},
+		{
+			"at most five codes", "",
+			"code 1001. code 1002. code 1003. code 1004. code 1005. code 1006.",
+			[]string{"1001", "1002", "1003", "1004", "1005"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractCodes(tt.subject, tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("extractCodes(%q, %q) = %q, want %q", tt.subject, tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyLink(t *testing.T) {
+	tests := []struct {
+		url  string
+		text string
+		want string
+	}{
+		{"https://example.com/reset-password?token=abc", "", store.LinkPasswordReset},
+		{"https://example.com/account/resetpassword/abc", "", store.LinkPasswordReset},
+		{"https://example.com/a/abc", "Reset your password", store.LinkPasswordReset},
+		{"https://example.com/recover?t=1", "", store.LinkPasswordReset},
+		{"https://example.com/auth/callback?code=abc", "", store.LinkMagicLink},
+		{"https://example.com/magic_link/abc", "", store.LinkMagicLink},
+		{"https://example.com/login?token=abc", "", store.LinkMagicLink},
+		{"https://example.com/e/abc", "Sign in to Example", store.LinkMagicLink},
+		{"https://example.com/verify-email?token=abc", "", store.LinkVerification},
+		{"https://example.com/confirmation/abc", "", store.LinkVerification},
+		{"https://example.com/t/abc", "Activate account", store.LinkVerification},
+		{"https://example.com/reset-password/verify", "", store.LinkPasswordReset},
+		{"https://github.com/author", "", ""},
+		{"https://example.com/authors/jane", "Our authors", ""},
+		{"https://example.com/blogin", "", ""},
+		{"https://example.com/presets", "", ""},
+		{"https://example.com/unsubscribe?u=1", "Unsubscribe", ""},
+		{"https://example.com/", "Visit our website", ""},
+	}
+
+	for _, tt := range tests {
+		if got := classifyLink(tt.url, tt.text); got != tt.want {
+			t.Errorf("classifyLink(%q, %q) = %q, want %q", tt.url, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	html := `<p>Welcome!</p>
+<a href="https://example.com/verify?token=a&amp;b=1">Confirm your email</a>
+<a href="https://example.com/blog">Read our blog</a>
+<a href='https://example.com/verify?token=a&amp;b=1'>Again</a>`
+	plain := "Or open https://example.com/login/abc. Follow us at https://social.example.com/author"
+
+	want := []store.MessageLink{
+		{URL: "https://example.com/verify?token=a&b=1", Kind: store.LinkVerification, Text: "Confirm your email"},
+		{URL: "https://example.com/login/abc", Kind: store.LinkMagicLink},
+	}
+	if got := extractLinks(html, plain); !slices.Equal(got, want) {
+		t.Errorf("extractLinks() = %+v, want %+v", got, want)
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	got := htmlToText(`<html><head><title>x</title></head><style>p{}</style><p>Your code is&nbsp;<b>123456</b></p></html>`)
+	if want := "Your code is\u00a0 123456"; got != want {
+		t.Errorf("htmlToText() = %q, want %q", got, want)
+	}
+}
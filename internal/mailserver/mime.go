@@ -0,0 +1,276 @@
+package mailserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+// maxMIMEDepth bounds how deeply nested multiparts and embedded messages are followed.
+const maxMIMEDepth = 16
+
+// attachmentExtensions overrides the first extension mime.ExtensionsByType would pick
+// (.asc for text/plain, .htm for text/html) for unnamed parts
+var attachmentExtensions = map[string]string{
+	"text/plain":     ".txt",
+	"text/html":      ".html",
+	"message/rfc822": ".eml",
+}
+
+// parsedBody is the result of walking a message's MIME tree. Every leaf part that
+// isn't used as the html or plain body is kept as an attachment.
+type parsedBody struct {
+	HTML        string
+	Plain       string
+	ContentType string
+	Tree        store.MessagePart
+	Attachments []store.Attachment
+}
+
+// mimeWalker collects the attachments found while walking a MIME tree.
+type mimeWalker struct {
+	attachments []store.Attachment
+}
+
+// partContent holds the best html and plain text bodies found in a subtree.
+type partContent struct {
+	html, plain string
+	// htmlPart and plainPart are the leaves the bodies come from, kept so that a body
+	// that loses to another one can still be stored as an attachment.
+	htmlPart, plainPart *textPart
+	// embedded is set for content coming from a message/rfc822 part, which is
+	// only used when the enclosing message has no body of its own.
+	embedded bool
+}
+
+// textPart is a text leaf with its transfer decoded content.
+type textPart struct {
+	node    store.MessagePart
+	content []byte
+}
+
+// parseMessageBody walks the MIME tree of a message body and picks the best HTML and
+// plain text alternatives from it. Malformed parts are logged and skipped rather than
+// failing the whole message.
+func parseMessageBody(body []byte, header headerGetter) *parsedBody {
+	walker := &mimeWalker{}
+	node, content := walker.walkPart(header, body, 0)
+
+	mediaType := node.ContentType
+	if !strings.HasPrefix(mediaType, "multipart/") && mediaType != "text/html" {
+		// Anything that isn't multipart or html is presented as plain text, as before
+		mediaType = "text/plain"
+	}
+
+	return &parsedBody{
+		HTML:        content.html,
+		Plain:       content.plain,
+		ContentType: mediaType,
+		Tree:        node,
+		Attachments: walker.attachments,
+	}
+}
+
+// walkPart describes a single MIME part and recurses into its children.
+func (w *mimeWalker) walkPart(header headerGetter, body []byte, depth int) (store.MessagePart, partContent) {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain; charset=us-ascii"
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		log.Printf("Malformed Content-Type ('%s'): %v. Treating part as plain text.", contentType, err)
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	node := store.MessagePart{
+		ContentType: mediaType,
+		Charset:     params["charset"],
+		Encoding:    strings.ToLower(header.Get("Content-Transfer-Encoding")),
+		ContentID:   strings.Trim(header.Get("Content-ID"), "<>"),
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	node.Disposition = disposition
+	node.Filename = decodeHeader(dispositionParams["filename"])
+	if node.Filename == "" {
+		node.Filename = decodeHeader(params["name"])
+	}
+
+	if depth >= maxMIMEDepth {
+		log.Printf("MIME tree exceeds %d levels. Not descending into '%s'.", maxMIMEDepth, mediaType)
+		node.Size = len(body)
+		return node, partContent{}
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return w.walkMultipart(node, body, params["boundary"], depth)
+	case mediaType == "message/rfc822":
+		// Forwarded messages are kept as .eml attachments as well as being walked
+		w.addAttachment(node, decodeTransferEncoding(body, node.Encoding))
+		return w.walkEmbeddedMessage(node, body, depth)
+	}
+
+	decoded := decodeTransferEncoding(body, node.Encoding)
+	node.Size = len(decoded)
+
+	// Text parts are the message text unless sent as attachments, a name alone doesn't make
+	// them files as some clients name their only body part
+	if disposition != "attachment" {
+		leaf := &textPart{node: node, content: decoded}
+		switch mediaType {
+		case "text/html":
+			return node, partContent{html: decodeCharset(decoded, node.Charset), htmlPart: leaf}
+		case "text/plain":
+			return node, partContent{plain: decodeCharset(decoded, node.Charset), plainPart: leaf}
+		}
+	}
+
+	w.addAttachment(node, decoded)
+	return node, partContent{}
+}
+
+// addAttachment records a leaf part that isn't used as the message body.
+func (w *mimeWalker) addAttachment(node store.MessagePart, content []byte) {
+	filename := node.Filename
+	if filename == "" {
+		filename = fmt.Sprintf("attachment-%d", len(w.attachments)+1)
+		if extension, ok := attachmentExtensions[node.ContentType]; ok {
+			filename += extension
+		} else if extensions, _ := mime.ExtensionsByType(node.ContentType); len(extensions) > 0 {
+			filename += extensions[0]
+		}
+	}
+
+	checksum := sha256.Sum256(content)
+	w.attachments = append(w.attachments, store.Attachment{
+		Filename:    filename,
+		ContentType: node.ContentType,
+		Size:        int64(len(content)),
+		ContentID:   node.ContentID,
+		Checksum:    hex.EncodeToString(checksum[:]),
+		Content:     content,
+	})
+}
+
+// walkMultipart walks every child of a multipart part and combines their bodies.
+func (w *mimeWalker) walkMultipart(node store.MessagePart, body []byte, boundary string, depth int) (store.MessagePart, partContent) {
+	node.Size = len(body)
+	if boundary == "" {
+		log.Printf("Multipart part '%s' lacks boundary. Treating it as plain text.", node.ContentType)
+		return node, partContent{plain: decodeCharset(body, "")}
+	}
+
+	var children []partContent
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		// NextRawPart leaves Content-Transfer-Encoding alone so every encoding is decoded the same way
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Error reading multipart part: %v. Ignoring the remaining parts.", err)
+			break
+		}
+
+		partBody, err := io.ReadAll(part)
+		part.Close()
+		if err != nil {
+			log.Printf("Failed to read part body for Content-Type '%s': %v. Skipping part.", part.Header.Get("Content-Type"), err)
+			continue
+		}
+
+		child, content := w.walkPart(part.Header, partBody, depth+1)
+		node.Parts = append(node.Parts, child)
+		children = append(children, content)
+	}
+
+	if node.ContentType == "multipart/alternative" {
+		return node, pickAlternative(children)
+	}
+	return node, w.pickFirst(children)
+}
+
+// walkEmbeddedMessage walks a message/rfc822 part, such as a forwarded email.
+func (w *mimeWalker) walkEmbeddedMessage(node store.MessagePart, body []byte, depth int) (store.MessagePart, partContent) {
+	node.Size = len(body)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(decodeTransferEncoding(body, node.Encoding)))
+	if err != nil {
+		log.Printf("Failed to parse embedded message: %v. Skipping part.", err)
+		return node, partContent{}
+	}
+
+	embeddedBody, err := io.ReadAll(msg.Body)
+	if err != nil {
+		log.Printf("Failed to read embedded message body: %v. Skipping part.", err)
+		return node, partContent{}
+	}
+
+	child, content := w.walkPart(msg.Header, embeddedBody, depth+1)
+	node.Parts = []store.MessagePart{child}
+	content.embedded = true
+	return node, content
+}
+
+// pickAlternative chooses between the children of a multipart/alternative part.
+// Senders list alternatives in increasing order of preference, so the last one wins.
+func pickAlternative(children []partContent) partContent {
+	var content partContent
+	for _, child := range children {
+		if child.html != "" {
+			content.html, content.htmlPart = child.html, child.htmlPart
+		}
+		if child.plain != "" {
+			content.plain, content.plainPart = child.plain, child.plainPart
+		}
+	}
+	return content
+}
+
+// pickFirst uses the first html and plain bodies of a multipart/mixed or
+// multipart/related part, falling back to embedded messages when there are none.
+// Later bodies are kept as attachments, embedded ones are already part of their .eml.
+func (w *mimeWalker) pickFirst(children []partContent) partContent {
+	var content, embedded partContent
+	var unused []*textPart
+	for _, child := range children {
+		target := &content
+		if child.embedded {
+			target = &embedded
+		}
+
+		if target.html == "" {
+			target.html, target.htmlPart = child.html, child.htmlPart
+		} else if child.htmlPart != nil && !child.embedded {
+			unused = append(unused, child.htmlPart)
+		}
+		if target.plain == "" {
+			target.plain, target.plainPart = child.plain, child.plainPart
+		} else if child.plainPart != nil && !child.embedded {
+			unused = append(unused, child.plainPart)
+		}
+	}
+
+	for _, leaf := range unused {
+		w.addAttachment(leaf.node, leaf.content)
+	}
+
+	if content.html == "" && content.plain == "" {
+		embedded.embedded = true
+		return embedded
+	}
+	return content
+}
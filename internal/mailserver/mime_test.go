@@ -0,0 +1,397 @@
+package mailserver
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// parseRaw parses a message written with \n line endings the way Data does
+func parseRaw(t *testing.T, raw string) *parsedBody {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(strings.ReplaceAll(raw, "\n", "\r\n")))
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	body, err := extractMessageBody(msg)
+	if err != nil {
+		t.Fatalf("failed to extract body: %v", err)
+	}
+	return body
+}
+
+func attachmentNames(body *parsedBody) []string {
+	names := []string{}
+	for _, attachment := range body.Attachments {
+		names = append(names, attachment.Filename)
+	}
+	return names
+}
+
+func TestParseMessageBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		plain       string
+		html        string
+		contentType string
+		attachments []string
+	}{
+		{
+			name: "plain text without content type",
+			raw: `Subject: hi
+
+Hello there
+`,
+			plain:       "Hello there\r\n",
+			contentType: "text/plain",
+			attachments: []string{},
+		},
+		{
+			name: "alternative nested in mixed",
+			raw: `Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/plain; charset=utf-8
+
+Plain body
+--inner
+Content-Type: text/html; charset=utf-8
+
+<p>HTML body</p>
+--inner--
+--outer
+Content-Type: application/pdf; name="invoice.pdf"
+Content-Disposition: attachment; filename="invoice.pdf"
+Content-Transfer-Encoding: base64
+
+JVBERi0xLjQK
+--outer--
+`,
+			plain:       "Plain body",
+			html:        "<p>HTML body</p>",
+			contentType: "multipart/mixed",
+			attachments: []string{"invoice.pdf"},
+		},
+		{
+			name: "named text part in mixed is an attachment",
+			raw: `Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+See the notes
+--b
+Content-Type: text/plain; name="notes.txt"
+
+Remember the milk
+--b--
+`,
+			plain:       "See the notes",
+			contentType: "multipart/mixed",
+			attachments: []string{"notes.txt"},
+		},
+		{
+			name: "named html as the only part is the body",
+			raw: `Content-Type: text/html; name="body.html"
+
+<p>Your code is 123456</p>
+`,
+			html:        "<p>Your code is 123456</p>\r\n",
+			contentType: "text/html",
+			attachments: []string{},
+		},
+		{
+			name: "named text as the only part is the body",
+			raw: `Content-Type: text/plain; name="msg.txt"
+
+Your code is 123456
+`,
+			plain:       "Your code is 123456\r\n",
+			contentType: "text/plain",
+			attachments: []string{},
+		},
+		{
+			name: "text sent as an attachment is not the body",
+			raw: `Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain; name="notes.txt"
+Content-Disposition: attachment; filename="notes.txt"
+
+Remember the milk
+--b
+Content-Type: text/plain
+
+See the notes
+--b--
+`,
+			plain:       "See the notes",
+			contentType: "multipart/mixed",
+			attachments: []string{"notes.txt"},
+		},
+		{
+			name: "later text parts in mixed are kept as attachments",
+			raw: `Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+First part
+--b
+Content-Type: image/png
+Content-Disposition: inline; filename="logo.png"
+Content-Transfer-Encoding: base64
+
+iVBORw0KGgo=
+--b
+Content-Type: text/plain
+
+Second part
+--b--
+`,
+			plain:       "First part",
+			contentType: "multipart/mixed",
+			attachments: []string{"logo.png", "attachment-2.txt"},
+		},
+		{
+			name: "forwarded message",
+			raw: `Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: message/rfc822
+
+From: someone@example.com
+Subject: original
+Content-Type: text/plain
+
+Forwarded body
+--b--
+`,
+			plain:       "Forwarded body",
+			contentType: "multipart/mixed",
+			attachments: []string{"attachment-1.eml"},
+		},
+		{
+			name: "forwarded message with a body of its own",
+			raw: `Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+See below
+--b
+Content-Type: message/rfc822
+
+Subject: original
+Content-Type: text/plain
+
+Forwarded body
+--b--
+`,
+			plain:       "See below",
+			contentType: "multipart/mixed",
+			attachments: []string{"attachment-1.eml"},
+		},
+		{
+			name: "base64 body",
+			raw: `Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: base64
+
+SGVsbG8sIHdv
+cmxkIQ
+`,
+			plain:       "Hello, world!",
+			contentType: "text/plain",
+			attachments: []string{},
+		},
+		{
+			name: "quoted-printable body",
+			raw: `Content-Type: text/html; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+<p style=3D"color: red">caf=C3=A9 is a very long line that was wrapped by the=
+ sender</p>
+`,
+			html:        "<p style=\"color: red\">café is a very long line that was wrapped by the sender</p>\r\n",
+			contentType: "text/html",
+			attachments: []string{},
+		},
+		{
+			name: "latin-1 quoted-printable body",
+			raw: `Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+Un caf=E9 cr=E8me
+`,
+			plain:       "Un café crème\r\n",
+			contentType: "text/plain",
+			attachments: []string{},
+		},
+		{
+			name:        "windows-1252 body in multipart",
+			raw:         "Content-Type: multipart/alternative; boundary=\"b\"\n\n--b\nContent-Type: text/plain; charset=windows-1252\nContent-Transfer-Encoding: 8bit\n\n\x93Quoted\x94 \x80 5\n--b--\n",
+			plain:       "“Quoted” € 5",
+			contentType: "multipart/alternative",
+			attachments: []string{},
+		},
+		{
+			name: "shift_jis body",
+			raw: `Content-Type: text/plain; charset=shift_jis
+Content-Transfer-Encoding: base64
+
+k/qWe4zq
+`,
+			plain:       "日本語",
+			contentType: "text/plain",
+			attachments: []string{},
+		},
+		{
+			name: "unknown charset is read as utf-8",
+			raw: `Content-Type: text/plain; charset=x-unknown
+
+plain ascii
+`,
+			plain:       "plain ascii\r\n",
+			contentType: "text/plain",
+			attachments: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := parseRaw(t, tt.raw)
+
+			if body.Plain != tt.plain {
+				t.Errorf("plain = %q, want %q", body.Plain, tt.plain)
+			}
+			if body.HTML != tt.html {
+				t.Errorf("html = %q, want %q", body.HTML, tt.html)
+			}
+			if body.ContentType != tt.contentType {
+				t.Errorf("content type = %q, want %q", body.ContentType, tt.contentType)
+			}
+			if names := attachmentNames(body); !slices.Equal(names, tt.attachments) {
+				t.Errorf("attachments = %q, want %q", names, tt.attachments)
+			}
+		})
+	}
+}
+
+func TestParseMessageBodyDecodesAttachments(t *testing.T) {
+	body := parseRaw(t, `Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+Body
+--b
+Content-Type: application/octet-stream; name="=?utf-8?q?r=C3=A9sum=C3=A9.bin?="
+Content-Transfer-Encoding: base64
+Content-ID: <part1@example.com>
+
+AAECAw==
+--b--
+`)
+
+	if len(body.Attachments) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(body.Attachments))
+	}
+	attachment := body.Attachments[0]
+	if attachment.Filename != "résumé.bin" {
+		t.Errorf("filename = %q, want %q", attachment.Filename, "résumé.bin")
+	}
+	if string(attachment.Content) != "\x00\x01\x02\x03" || attachment.Size != 4 {
+		t.Errorf("content = %q (size %d), want 4 decoded bytes", attachment.Content, attachment.Size)
+	}
+	if attachment.ContentID != "part1@example.com" {
+		t.Errorf("content id = %q, want %q", attachment.ContentID, "part1@example.com")
+	}
+}
+
+func TestParseMessageBodyDepthLimit(t *testing.T) {
+	nested := func(levels int) string {
+		var raw strings.Builder
+		raw.WriteString("Content-Type: multipart/mixed; boundary=\"b0\"\n\n")
+		for i := 0; i < levels; i++ {
+			fmt.Fprintf(&raw, "--b%d\nContent-Type: multipart/mixed; boundary=\"b%d\"\n\n", i, i+1)
+		}
+		fmt.Fprintf(&raw, "--b%d\nContent-Type: text/plain\n\nDeep body\n--b%d--\n", levels, levels)
+		for i := levels - 1; i >= 0; i-- {
+			fmt.Fprintf(&raw, "--b%d--\n", i)
+		}
+		return raw.String()
+	}
+
+	if body := parseRaw(t, nested(maxMIMEDepth-2)); body.Plain != "Deep body" {
+		t.Errorf("plain = %q within the depth limit, want %q", body.Plain, "Deep body")
+	}
+
+	body := parseRaw(t, nested(maxMIMEDepth+4))
+	if body.Plain != "" || len(body.Attachments) != 0 {
+		t.Errorf("plain = %q with %d attachments past the depth limit, want nothing", body.Plain, len(body.Attachments))
+	}
+
+	depth, part := 0, &body.Tree
+	for len(part.Parts) > 0 {
+		depth, part = depth+1, &part.Parts[0]
+	}
+	if depth != maxMIMEDepth {
+		t.Errorf("tree is %d levels deep, want it cut at %d", depth, maxMIMEDepth)
+	}
+}
+
+func TestDecodeTransferEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+		want     string
+	}{
+		{"base64", "aGVsbG8=", "base64", "hello"},
+		{"base64 with line breaks and no padding", "aGVs\r\nbG8", "Base64", "hello"},
+		{"invalid base64 is kept", "not base64!", "base64", "not base64!"},
+		{"quoted-printable", "caf=C3=A9 =\r\nbar", "quoted-printable", "café bar"},
+		{"7bit", "as is", "7bit", "as is"},
+		{"unknown encoding", "as is", "x-uuencode", "as is"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(decodeTransferEncoding([]byte(tt.body), tt.encoding)); got != tt.want {
+				t.Errorf("decodeTransferEncoding(%q, %q) = %q, want %q", tt.body, tt.encoding, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		charset string
+		want    string
+	}{
+		{"utf-8", "café", "UTF-8", "café"},
+		{"no charset", "café", "", "café"},
+		{"invalid utf-8", "caf\xe9", "", "caf�"},
+		{"latin-1", "caf\xe9", "ISO-8859-1", "café"},
+		{"windows-1252", "\x80", "windows-1252", "€"},
+		{"koi8-r", "\xf0\xd2\xc9\xd7\xc5\xd4", "koi8-r", "Привет"},
+		{"unknown charset", "café", "x-made-up", "café"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeCharset([]byte(tt.body), tt.charset); got != tt.want {
+				t.Errorf("decodeCharset(%q, %q) = %q, want %q", tt.body, tt.charset, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,56 +4,80 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime"
-	"mime/multipart"
 	"net/mail"
 	"strings"
 	"time"
 
 	"github.com/emersion/go-smtp"
 
-	"github.com/AmoabaKelvin/temp-mail/internal/db"
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
 	"github.com/AmoabaKelvin/temp-mail/internal/store"
 )
 
+// snippetLength is the number of characters of the body kept for inbox listings
+const snippetLength = 200
+
 // Backend implements SMTP server methods.
 type Backend struct {
-	store *store.Storage
+	store  *store.Storage
+	events events.Publisher
+}
+
+// NewBackend returns a Backend storing messages in storage and announcing them on publisher
+func NewBackend(storage *store.Storage, publisher events.Publisher) *Backend {
+	return &Backend{store: storage, events: publisher}
 }
 
 func (bkd *Backend) NewSession(_ *smtp.Conn) (smtp.Session, error) {
-	return &Session{store: bkd.store}, nil
+	return &Session{store: bkd.store, events: bkd.events}, nil
 }
 
 // Session is returned after EHLO.
 type Session struct {
-	From  string
-	To    []string
-	store *store.Storage
+	From   string
+	To     []string
+	store  *store.Storage
+	events events.Publisher
+
+	// addresses holds the resolved address for each entry in To.
+	addresses []*store.Address
 }
 
 func (s *Session) Session() {
 	s.From = ""
 	s.To = []string{}
+	s.addresses = nil
 }
 
 func (s *Session) Mail(from string, opts *smtp.MailOptions) error {
-	fmt.Println("Mail from:", from)
 	s.From = from
 	return nil
 }
 
 func (s *Session) Rcpt(to string, _ *smtp.RcptOptions) error {
-	fmt.Println("Rcpt to:", to)
+	address, err := validateRecipient(s.store, to)
+	if err != nil {
+		log.Printf("Rejecting recipient %s: %v", to, err)
+		return err
+	}
+
+	// A repeated recipient is accepted again but only gets one copy
+	for _, accepted := range s.addresses {
+		if accepted.ID == address.ID {
+			return nil
+		}
+	}
+
 	s.To = append(s.To, to)
+	s.addresses = append(s.addresses, address)
 	return nil
 }
 
 func (s *Session) Logout() error {
-	fmt.Println("Logging out")
 	return nil
 }
 
@@ -73,55 +97,105 @@ func readAndParseMessage(r io.Reader) (*mail.Message, []byte, error) {
 	return msg, rawData, nil
 }
 
-// validateRecipient checks if the recipient address exists and is not expired
-func validateRecipient(store *store.Storage, address string) (*store.Address, error) {
+var (
+	errMailboxNotFound = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 1, 1},
+		Message:      "Mailbox does not exist",
+	}
+	errMailboxExpired = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 1, 6},
+		Message:      "Mailbox has expired",
+	}
+	errLookupFailed = &smtp.SMTPError{
+		Code:         451,
+		EnhancedCode: smtp.EnhancedCode{4, 3, 0},
+		Message:      "Temporary failure looking up mailbox, try again later",
+	}
+	errStoreFailed = &smtp.SMTPError{
+		Code:         451,
+		EnhancedCode: smtp.EnhancedCode{4, 3, 0},
+		Message:      "Temporary failure storing message, try again later",
+	}
+)
+
+// validateRecipient checks if the recipient address exists and is not expired.
+// Failures are returned as SMTP errors so the sender gets a meaningful reply code.
+func validateRecipient(storage *store.Storage, address string) (*store.Address, error) {
 	ctx := context.Background()
-	addr, err := store.Addresses.Get(ctx, address)
-	if err != nil {
-		return nil, fmt.Errorf("receiver address '%s' not found: %w", address, err)
+	// Addresses are stored in lower case, senders may change the case of either part
+	addr, err := storage.Addresses.Get(ctx, strings.ToLower(address))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, errMailboxNotFound
+	} else if err != nil {
+		log.Printf("Failed to look up receiver address '%s': %v", address, err)
+		return nil, errLookupFailed
 	}
 
 	if addr.ExpiresAt.Before(time.Now()) {
-		return nil, fmt.Errorf("receiver address '%s' has expired", address)
+		return nil, errMailboxExpired
 	}
 
 	return addr, nil
 }
 
 // extractMessageBody reads and processes the message body to extract both HTML and plain text versions
-func extractMessageBody(msg *mail.Message) (htmlBody, plainBody, contentType string, err error) {
+func extractMessageBody(msg *mail.Message) (*parsedBody, error) {
 	rawBodyBytes, err := io.ReadAll(msg.Body)
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to read raw message body: %w", err)
+		return nil, fmt.Errorf("failed to read raw message body: %w", err)
 	}
 
-	html, plain, ctype := parseMessageBody(rawBodyBytes, msg.Header)
-	return html, plain, ctype, nil
+	return parseMessageBody(rawBodyBytes, msg.Header), nil
 }
 
 // createMessage constructs a store.Message from the parsed email data
-func createMessage(from, subject, htmlBody, plainBody, contentType string, headers []byte, addressID uint) store.Message {
+func createMessage(from, subject string, body *parsedBody, headers, raw []byte, addressID uint) store.Message {
 	// Convert strings to pointers for nullable fields
 	var htmlPtr, plainPtr *string
-	if htmlBody != "" {
-		htmlPtr = &htmlBody
+	if body.HTML != "" {
+		htmlPtr = &body.HTML
 	}
-	if plainBody != "" {
-		plainPtr = &plainBody
+	if body.Plain != "" {
+		plainPtr = &body.Plain
 	}
 
+	// Every recipient gets its own copy of the attachments
+	attachments := make([]store.Attachment, len(body.Attachments))
+	copy(attachments, body.Attachments)
+
+	tree := body.Tree
 	return store.Message{
+		Snippet:     makeSnippet(body),
 		BodyHTML:    htmlPtr,
 		BodyPlain:   plainPtr,
-		ContentType: contentType,
+		MIMETree:    &tree,
+		Attachments: attachments,
+		ContentType: body.ContentType,
 		FromAddress: from,
 		ToAddressID: addressID,
 		ReceivedAt:  time.Now(),
 		Subject:     subject,
 		Headers:     headers,
+		Raw:         raw,
 	}
 }
 
+// makeSnippet returns the start of the message text for inbox listings
+func makeSnippet(body *parsedBody) string {
+	text := body.Plain
+	if text == "" {
+		text = htmlToText(body.HTML)
+	}
+	text = strings.Join(strings.Fields(text), " ")
+
+	if runes := []rune(text); len(runes) > snippetLength {
+		return strings.TrimSpace(string(runes[:snippetLength])) + "…"
+	}
+	return text
+}
+
 // storeMessage persists the message to the database
 func storeMessage(storage *store.Storage, message *store.Message) error {
 	ctx := context.Background()
@@ -131,119 +205,116 @@ func storeMessage(storage *store.Storage, message *store.Message) error {
 	return nil
 }
 
-// parseMultipartBody extracts text parts from a multipart message
-func parseMultipartBody(bodyBytes []byte, boundary string) (htmlBody, plainBody string, err error) {
-	mr := multipart.NewReader(bytes.NewReader(bodyBytes), boundary)
+// deliver stores a copy of msg for every recipient accepted during the transaction.
+// It returns one result per entry in s.To, in the same order, so a bad recipient
+// never prevents delivery to the others. The returned error is only set when the
+// message itself could not be processed.
+func (s *Session) deliver(msg *mail.Message, rawData []byte) ([]error, error) {
+	// Marshal headers for storage
+	headersJSON, err := json.Marshal(msg.Header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal headers: %w", err)
+	}
 
-	for {
-		part, partErr := mr.NextPart()
-		if partErr == io.EOF {
-			break
-		}
-		if partErr != nil {
-			return "", "", fmt.Errorf("error reading multipart part: %w", partErr)
-		}
-		defer part.Close()
+	// Extract and process message body
+	body, err := extractMessageBody(msg)
+	if err != nil {
+		return nil, err
+	}
 
-		partContentType := part.Header.Get("Content-Type")
-		partMediaType, _, parseErr := mime.ParseMediaType(partContentType)
-		if parseErr != nil {
-			log.Printf("Skipping part with malformed Content-Type ('%s'): %v", partContentType, parseErr)
-			continue
-		}
+	subject := decodeHeader(msg.Header.Get("Subject"))
+	codes, links := extractCodesAndLinks(subject, body)
 
-		partBodyBytes, readErr := io.ReadAll(part)
-		if readErr != nil {
-			log.Printf("Failed to read part body for Content-Type '%s': %v. Skipping part.", partContentType, readErr)
+	results := make([]error, len(s.To))
+	for i, rcpt := range s.To {
+		address := s.addresses[i]
+		if address.ExpiresAt.Before(time.Now()) {
+			log.Printf("Rejecting message for %s: address expired during the transaction", rcpt)
+			results[i] = errMailboxExpired
 			continue
 		}
 
-		switch partMediaType {
-		case "text/html":
-			htmlBody = string(partBodyBytes)
-		case "text/plain":
-			plainBody = string(partBodyBytes)
-		}
-	}
-
-	return htmlBody, plainBody, nil
-}
+		// Create message object
+		message := createMessage(s.From, subject, body, headersJSON, rawData, uint(address.ID))
+		message.Codes, message.Links = codes, links
 
-// parseMessageBody tries to extract both HTML and plain text body parts from the email body.
-// Returns htmlBody, plainBody, and contentType. For non-multipart messages, one of the body
-// fields will be populated based on the content type, and the other will be empty.
-func parseMessageBody(originalBodyBytes []byte, header mail.Header) (htmlBody, plainBody, contentType string) {
-	contentType = header.Get("Content-Type")
-	mediaType, params, err := mime.ParseMediaType(contentType)
-	if err != nil {
-		log.Printf("Malformed Content-Type ('%s'): %v. Returning raw body as plain text.", contentType, err)
-		return "", string(originalBodyBytes), "text/plain"
-	}
+		// Log the operation
+		log.Printf("Storing message for %s, Subject: %s, HTML length: %d, Plain length: %d, Attachments: %d, Content-Type: %s",
+			rcpt, subject, len(body.HTML), len(body.Plain), len(body.Attachments), body.ContentType)
 
-	if strings.HasPrefix(mediaType, "multipart/") {
-		boundary := params["boundary"]
-		if boundary == "" {
-			log.Println("Multipart message lacks boundary. Returning raw body as plain text.")
-			return "", string(originalBodyBytes), mediaType
-		}
-
-		html, plain, err := parseMultipartBody(originalBodyBytes, boundary)
-		if err != nil {
-			log.Printf("Error parsing multipart body: %v. Returning raw body as plain text.", err)
-			return "", string(originalBodyBytes), mediaType
+		// Store the message
+		if err := storeMessage(s.store, &message); err != nil {
+			log.Printf("Failed to store message for %s: %v", rcpt, err)
+			results[i] = errStoreFailed
+			continue
 		}
 
-		return html, plain, mediaType
+		log.Printf("Successfully stored message ID %d for %s", message.ID, rcpt)
 
-	} else if mediaType == "text/html" {
-		return string(originalBodyBytes), "", mediaType
-	} else if mediaType == "text/plain" {
-		return "", string(originalBodyBytes), mediaType
+		// Listeners re-check the store, so a lost notification only delays them
+		event := events.Event{Type: events.MessageCreated, AddressID: address.ID, MessageID: int64(message.ID)}
+		if err := s.events.Publish(context.Background(), event); err != nil {
+			log.Printf("Failed to publish %s event for message ID %d: %v", event.Type, message.ID, err)
+		}
 	}
 
-	log.Printf("Content-Type '%s' is not multipart or simple text. Storing raw body as plain text.", mediaType)
-	return "", string(originalBodyBytes), "text/plain"
+	return results, nil
 }
 
 func (s *Session) Data(r io.Reader) error {
 	// Read and parse the incoming email
-	msg, _, err := readAndParseMessage(r)
+	msg, rawData, err := readAndParseMessage(r)
 	if err != nil {
 		return err
 	}
 
-	// Marshal headers for storage
-	headersJSON, err := json.Marshal(msg.Header)
+	results, err := s.deliver(msg, rawData)
 	if err != nil {
-		return fmt.Errorf("failed to marshal headers: %w", err)
+		return err
 	}
 
-	// Validate recipient address
-	address, err := validateRecipient(s.store, s.To[0])
-	if err != nil {
-		return err
+	// SMTP only has a single reply for the whole transaction, so the message is
+	// accepted as long as at least one recipient got a copy. Recipients whose copy
+	// failed to store then lose it, as failing the transaction would make the sender
+	// deliver it again to every recipient. LMTP, served on LMTP_PORT, reports each
+	// recipient separately instead.
+	for _, result := range results {
+		if result == nil {
+			return nil
+		}
+	}
+	if len(results) == 0 {
+		return &smtp.SMTPError{
+			Code:         554,
+			EnhancedCode: smtp.EnhancedCode{5, 5, 1},
+			Message:      "No valid recipients",
+		}
 	}
+	// Every copy failed, ask the sender to retry if any of them may succeed later
+	for _, result := range results {
+		if result == errStoreFailed {
+			return result
+		}
+	}
+	return results[0]
+}
 
-	// Extract and process message body
-	htmlBody, plainBody, contentType, err := extractMessageBody(msg)
+// LMTPData is the LMTP variant of Data, reporting a separate status for every recipient
+// so the sender retries only the ones that failed.
+func (s *Session) LMTPData(r io.Reader, status smtp.StatusCollector) error {
+	msg, rawData, err := readAndParseMessage(r)
 	if err != nil {
 		return err
 	}
 
-	// Create message object
-	subject := msg.Header.Get("Subject")
-	message := createMessage(s.From, subject, htmlBody, plainBody, contentType, headersJSON, uint(address.ID))
-
-	// Log the operation
-	log.Printf("Storing message for %s, Subject: %s, HTML length: %d, Plain length: %d, Content-Type: %s",
-		s.To[0], subject, len(htmlBody), len(plainBody), contentType)
-
-	// Store the message
-	if err := storeMessage(s.store, &message); err != nil {
+	results, err := s.deliver(msg, rawData)
+	if err != nil {
 		return err
 	}
 
-	log.Printf("Successfully stored message ID %d for %s", message.ID, s.To[0])
+	for i, rcpt := range s.To {
+		status.SetStatus(rcpt, results[i])
+	}
 	return nil
 }
 
@@ -258,29 +329,36 @@ func (s *Session) AuthPlain(username, password string) error {
 func (s *Session) Reset() {
 	s.From = ""
 	s.To = []string{}
+	s.addresses = nil
 }
 
 func (s *Session) Quit() error {
-	fmt.Println("Quitting")
 	return nil
 }
 
-// Start initializes and starts the SMTP mail server
-func Start(databaseUrl, port string) error {
-	database, err := db.New(databaseUrl)
-	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+// Start initializes and starts the SMTP mail server. Every stored message is announced on publisher.
+func Start(storage *store.Storage, publisher events.Publisher, port string) error {
+	server := smtp.NewServer(NewBackend(storage, publisher))
+	server.Addr = fmt.Sprintf("0.0.0.0:%s", port)
+
+	log.Printf("Starting SMTP server on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil {
+		return fmt.Errorf("failed to start SMTP server: %w", err)
 	}
 
-	storage := store.NewStorage(database)
+	return nil
+}
 
-	backend := &Backend{store: storage}
-	server := smtp.NewServer(backend)
+// StartLMTP starts the mail server speaking LMTP, which gives every recipient its own reply.
+// It is meant for a relay such as Postfix delivering to it, not for the public internet.
+func StartLMTP(storage *store.Storage, publisher events.Publisher, port string) error {
+	server := smtp.NewServer(NewBackend(storage, publisher))
 	server.Addr = fmt.Sprintf("0.0.0.0:%s", port)
+	server.LMTP = true
 
-	log.Printf("Starting SMTP server on %s", server.Addr)
+	log.Printf("Starting LMTP server on %s", server.Addr)
 	if err := server.ListenAndServe(); err != nil {
-		return fmt.Errorf("failed to start SMTP server: %w", err)
+		return fmt.Errorf("failed to start LMTP server: %w", err)
 	}
 
 	return nil
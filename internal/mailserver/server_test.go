@@ -0,0 +1,114 @@
+package mailserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-smtp"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+const testMessage = "From: sender@example.com\r\nSubject: Hello\r\n\r\nYour code is 482913\r\n"
+
+// newTestSession returns a session on memory storage holding an address for every email
+func newTestSession(t *testing.T, emails ...string) (*Session, []*store.Address) {
+	t.Helper()
+
+	storage := store.NewMemoryStorage()
+	var addresses []*store.Address
+	for _, email := range emails {
+		address := &store.Address{Email: email, TokenHash: []byte(email), ExpiresAt: time.Now().Add(time.Hour)}
+		if err := storage.Addresses.Create(context.Background(), address); err != nil {
+			t.Fatalf("failed to create address: %v", err)
+		}
+		addresses = append(addresses, address)
+	}
+
+	session := &Session{store: storage, events: events.NewLocalBus()}
+	for _, email := range emails {
+		if err := session.Rcpt(email, nil); err != nil {
+			t.Fatalf("Rcpt(%s) failed: %v", email, err)
+		}
+	}
+	return session, addresses
+}
+
+func messageCount(t *testing.T, s *Session, address *store.Address) int64 {
+	t.Helper()
+
+	total, _, err := s.store.Messages.Count(context.Background(), address.ID)
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	return total
+}
+
+func TestDataDeliversToEveryRecipient(t *testing.T) {
+	session, addresses := newTestSession(t, "one@example.com", "two@example.com")
+	if err := session.Rcpt("ONE@example.com", nil); err != nil {
+		t.Fatalf("Rcpt of a repeated recipient failed: %v", err)
+	}
+
+	if err := session.Data(strings.NewReader(testMessage)); err != nil {
+		t.Fatalf("Data failed: %v", err)
+	}
+	for _, address := range addresses {
+		if total := messageCount(t, session, address); total != 1 {
+			t.Errorf("%s has %d messages, want 1", address.Email, total)
+		}
+	}
+}
+
+func TestDataStoreFailure(t *testing.T) {
+	session, addresses := newTestSession(t, "one@example.com", "two@example.com")
+
+	// Deleting an address after RCPT makes storing its copy fail
+	if err := session.store.Addresses.Delete(context.Background(), addresses[0].ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := session.Data(strings.NewReader(testMessage)); err != nil {
+		t.Errorf("Data with one recipient left returned %v, want the message accepted", err)
+	}
+	if total := messageCount(t, session, addresses[1]); total != 1 {
+		t.Errorf("%s has %d messages, want 1", addresses[1].Email, total)
+	}
+
+	if err := session.store.Addresses.Delete(context.Background(), addresses[1].ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	var smtpErr *smtp.SMTPError
+	err := session.Data(strings.NewReader(testMessage))
+	if !errors.As(err, &smtpErr) || smtpErr.Code != 451 {
+		t.Errorf("Data with every copy failing returned %v, want a 451 reply", err)
+	}
+}
+
+// statusCollector records the LMTP status of every recipient
+type statusCollector map[string]error
+
+func (c statusCollector) SetStatus(rcpt string, err error) {
+	c[rcpt] = err
+}
+
+func TestLMTPDataReportsEveryRecipient(t *testing.T) {
+	session, addresses := newTestSession(t, "one@example.com", "two@example.com")
+	if err := session.store.Addresses.Delete(context.Background(), addresses[0].ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	status := statusCollector{}
+	if err := session.LMTPData(strings.NewReader(testMessage), status); err != nil {
+		t.Fatalf("LMTPData failed: %v", err)
+	}
+	if err := status["one@example.com"]; err != errStoreFailed {
+		t.Errorf("status of the deleted address = %v, want %v", err, errStoreFailed)
+	}
+	if err, ok := status["two@example.com"]; !ok || err != nil {
+		t.Errorf("status of the live address = %v, %t, want success", err, ok)
+	}
+}
@@ -0,0 +1,15 @@
+package store
+
+import "time"
+
+type Attachment struct {
+	ID          int64     `json:"id"`
+	MessageID   int64     `json:"message_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	ContentID   string    `json:"content_id,omitempty"`
+	Checksum    string    `json:"checksum"` // hex encoded SHA-256 of Content
+	Content     []byte    `json:"-"`
+	CreatedAt   time.Time `json:"-"`
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memory holds the data of the in-memory stores. The stores share a single lock so that
+// cascading deletes and message creation are atomic, like the transactions of the SQL stores.
+type memory struct {
+	mu sync.RWMutex
+
+	addresses   map[int64]*Address
+	messages    map[uint]*Message
+	attachments map[int64]*Attachment
+	webhooks    map[int64]*Webhook
+	deliveries  map[int64]*memoryDelivery
+	attempts    []WebhookAttempt
+
+	lastAddressID    int64
+	lastMessageID    uint
+	lastAttachmentID int64
+	lastWebhookID    int64
+	lastDeliveryID   int64
+	lastAttemptID    int64
+}
+
+// NewMemoryStorage returns stores that keep everything in memory, for tests and throwaway
+// deployments. They are safe for concurrent use and behave like the SQL stores, but nothing
+// survives a restart and the data isn't shared between processes.
+func NewMemoryStorage() *Storage {
+	m := &memory{
+		addresses:   make(map[int64]*Address),
+		messages:    make(map[uint]*Message),
+		attachments: make(map[int64]*Attachment),
+		webhooks:    make(map[int64]*Webhook),
+		deliveries:  make(map[int64]*memoryDelivery),
+	}
+
+	return &Storage{
+		Messages:    &MemoryMessageStore{m: m},
+		Addresses:   &MemoryAddressStore{m: m},
+		Attachments: &MemoryAttachmentStore{m: m},
+		Webhooks:    &MemoryWebhookStore{m: m},
+	}
+}
+
+type MemoryAddressStore struct {
+	m *memory
+}
+
+// Create stores a new address, returning ErrConflict when the email or token is already taken
+func (s *MemoryAddressStore) Create(ctx context.Context, address *Address) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, existing := range s.m.addresses {
+		if existing.Email == address.Email || (address.TokenHash != nil && bytes.Equal(existing.TokenHash, address.TokenHash)) {
+			return ErrConflict
+		}
+	}
+
+	s.m.lastAddressID++
+	address.ID = s.m.lastAddressID
+	address.CreatedAt = time.Now()
+
+	s.m.addresses[address.ID] = &Address{
+		ID:        address.ID,
+		Email:     address.Email,
+		TokenHash: address.TokenHash,
+		ExpiresAt: address.ExpiresAt,
+		CreatedAt: address.CreatedAt,
+	}
+	return nil
+}
+
+func (s *MemoryAddressStore) Get(ctx context.Context, email string) (*Address, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	for _, address := range s.m.addresses {
+		if address.Email == email {
+			found := *address
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetByTokenHash gets the address an access token was issued for. Tokens stop working with
+// ErrExpired once the address expires, before the sweeper gets to delete it.
+func (s *MemoryAddressStore) GetByTokenHash(ctx context.Context, tokenHash []byte) (*Address, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	for _, address := range s.m.addresses {
+		if bytes.Equal(address.TokenHash, tokenHash) {
+			if !address.ExpiresAt.After(time.Now()) {
+				return nil, ErrExpired
+			}
+			found := *address
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// SetExpiresAt moves the expiry of an address
+func (s *MemoryAddressStore) SetExpiresAt(ctx context.Context, id int64, expiresAt time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	address, ok := s.m.addresses[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	address.ExpiresAt = expiresAt
+	return nil
+}
+
+// Delete permanently deletes an address along with its messages, attachments and webhooks
+func (s *MemoryAddressStore) Delete(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.addresses[id]; !ok {
+		return ErrNotFound
+	}
+
+	s.m.deleteAddress(id)
+	return nil
+}
+
+// DeleteExpired permanently deletes up to limit addresses that expired before the given time,
+// along with their messages and attachments
+func (s *MemoryAddressStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (addresses, messages int64, err error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	expired := []*Address{}
+	for _, address := range s.m.addresses {
+		if address.ExpiresAt.Before(before) {
+			expired = append(expired, address)
+		}
+	}
+	slices.SortFunc(expired, func(a, b *Address) int {
+		return a.ExpiresAt.Compare(b.ExpiresAt)
+	})
+
+	for _, address := range expired[:min(limit, len(expired))] {
+		messages += s.m.deleteAddress(address.ID)
+		addresses++
+	}
+
+	return addresses, messages, nil
+}
+
+// deleteAddress removes an address and everything belonging to it, returning the number of
+// messages deleted. The caller must hold the write lock.
+func (m *memory) deleteAddress(id int64) int64 {
+	var messages int64
+	for messageID, message := range m.messages {
+		if int64(message.ToAddressID) == id {
+			m.deleteMessage(messageID)
+			messages++
+		}
+	}
+
+	for webhookID, webhook := range m.webhooks {
+		if webhook.AddressID == id {
+			m.deleteWebhook(webhookID)
+		}
+	}
+
+	delete(m.addresses, id)
+	return messages
+}
+
+// deleteMessage removes a message with its attachments and webhook deliveries. The caller
+// must hold the write lock.
+func (m *memory) deleteMessage(id uint) {
+	for attachmentID, attachment := range m.attachments {
+		if attachment.MessageID == int64(id) {
+			delete(m.attachments, attachmentID)
+		}
+	}
+
+	for deliveryID, delivery := range m.deliveries {
+		if delivery.MessageID == int64(id) {
+			m.deleteDelivery(deliveryID)
+		}
+	}
+
+	delete(m.messages, id)
+}
+
+type MemoryAttachmentStore struct {
+	m *memory
+}
+
+// GetByMessageID gets the metadata of every attachment of a message, without their content
+func (s *MemoryAttachmentStore) GetByMessageID(ctx context.Context, messageID int64) ([]Attachment, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	attachments := []Attachment{}
+	for _, attachment := range s.m.attachments {
+		if attachment.MessageID == messageID {
+			found := *attachment
+			found.Content = nil
+			attachments = append(attachments, found)
+		}
+	}
+	slices.SortFunc(attachments, func(a, b Attachment) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return attachments, nil
+}
+
+// GetByID gets a single attachment of a message, including its content
+func (s *MemoryAttachmentStore) GetByID(ctx context.Context, messageID, attachmentID int64) (*Attachment, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	attachment, ok := s.m.attachments[attachmentID]
+	if !ok || attachment.MessageID != messageID {
+		return nil, ErrNotFound
+	}
+
+	found := *attachment
+	return &found, nil
+}
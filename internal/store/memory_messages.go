@@ -0,0 +1,453 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// memoryHighlightRadius is the number of characters kept on each side of the first match
+// in search highlights
+const memoryHighlightRadius = 80
+
+var (
+	memoryStyleBlock = regexp.MustCompile(`(?is)<(style|script)\b.*?</(style|script)>`)
+	memoryTag        = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+type MemoryMessageStore struct {
+	m *memory
+}
+
+// List gets the summaries of the messages of an address matching the filter, newest first
+func (s *MemoryMessageStore) List(ctx context.Context, addressID int64, filter MessageFilter) ([]MessageSummary, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	messages := s.m.find(addressID, filter)
+	slices.Reverse(messages)
+	if filter.Cursor != nil {
+		messages = slices.DeleteFunc(messages, func(message *Message) bool {
+			return !message.ReceivedAt.Before(filter.Cursor.ReceivedAt) &&
+				!(message.ReceivedAt.Equal(filter.Cursor.ReceivedAt) && message.ID < filter.Cursor.ID)
+		})
+	}
+	if filter.Limit > 0 && len(messages) > filter.Limit {
+		messages = messages[:filter.Limit]
+	}
+
+	summaries := []MessageSummary{}
+	for _, message := range messages {
+		summaries = append(summaries, s.m.summarize(message))
+	}
+	return summaries, nil
+}
+
+// Find gets the messages of an address matching the filter, oldest first
+func (s *MemoryMessageStore) Find(ctx context.Context, addressID int64, filter MessageFilter) ([]Message, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	matches := s.m.find(addressID, filter)
+	if filter.Limit > 0 && len(matches) > filter.Limit {
+		matches = matches[:filter.Limit]
+	}
+
+	messages := []Message{}
+	for _, message := range matches {
+		messages = append(messages, copyMessage(message))
+	}
+	return messages, nil
+}
+
+// find gets the messages of an address that aren't in the trash and match the filter, except
+// for its cursor and limit, oldest first. The caller must hold the lock.
+func (m *memory) find(addressID int64, filter MessageFilter) []*Message {
+	messages := []*Message{}
+	for _, message := range m.messages {
+		if int64(message.ToAddressID) != addressID || message.DeletedAt != nil {
+			continue
+		}
+		if !filter.ReceivedAfter.IsZero() && !message.ReceivedAt.After(filter.ReceivedAfter) {
+			continue
+		}
+		if !filter.ReceivedBefore.IsZero() && !message.ReceivedAt.Before(filter.ReceivedBefore) {
+			continue
+		}
+		if filter.From != "" && !strings.Contains(strings.ToLower(message.FromAddress), strings.ToLower(filter.From)) {
+			continue
+		}
+		if filter.Subject != "" && !strings.Contains(strings.ToLower(message.Subject), strings.ToLower(filter.Subject)) {
+			continue
+		}
+		if filter.Unread && message.ReadAt != nil {
+			continue
+		}
+		if filter.HasAttachments != nil && m.hasAttachments(message.ID) != *filter.HasAttachments {
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	slices.SortFunc(messages, func(a, b *Message) int {
+		if c := a.ReceivedAt.Compare(b.ReceivedAt); c != 0 {
+			return c
+		}
+		return int(a.ID) - int(b.ID)
+	})
+	return messages
+}
+
+func (m *memory) hasAttachments(messageID uint) bool {
+	for _, attachment := range m.attachments {
+		if attachment.MessageID == int64(messageID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memory) summarize(message *Message) MessageSummary {
+	return MessageSummary{
+		ID:             message.ID,
+		FromAddress:    message.FromAddress,
+		Subject:        message.Subject,
+		Snippet:        message.Snippet,
+		Codes:          message.Codes,
+		Links:          message.Links,
+		ReceivedAt:     message.ReceivedAt,
+		ReadAt:         message.ReadAt,
+		HasAttachments: m.hasAttachments(message.ID),
+	}
+}
+
+// Search gets the messages of an address matching a web search style query such as
+// `"password reset" staging -prod`, ranked by how often the terms appear with subject matches
+// counting the most. Terms match anywhere in a word rather than by stem like the SQL stores.
+func (s *MemoryMessageStore) Search(ctx context.Context, addressID int64, q string, limit int) ([]MessageSearchResult, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	results := []MessageSearchResult{}
+	clauses, excluded := parseSearchQuery(q)
+	if len(clauses) == 0 {
+		return results, nil
+	}
+
+	for _, message := range s.m.find(addressID, MessageFilter{}) {
+		subject := strings.ToLower(message.Subject)
+		from := strings.ToLower(message.FromAddress)
+		body := messageText(message)
+		lowerBody := strings.ToLower(body)
+		occurrences := func(term string) int {
+			return 10*strings.Count(subject, term) + 5*strings.Count(from, term) + strings.Count(lowerBody, term)
+		}
+
+		if slices.ContainsFunc(excluded, func(term string) bool { return occurrences(term) > 0 }) {
+			continue
+		}
+
+		var rank float64
+		var matched []string
+		for _, alternatives := range clauses {
+			count := 0
+			for _, term := range alternatives {
+				if n := occurrences(term); n > 0 {
+					count += n
+					matched = append(matched, term)
+				}
+			}
+			if count == 0 {
+				rank = 0
+				break
+			}
+			rank += float64(count)
+		}
+		if rank == 0 {
+			continue
+		}
+
+		results = append(results, MessageSearchResult{
+			MessageSummary: s.m.summarize(message),
+			Rank:           rank,
+			Highlight:      highlight(body, matched),
+		})
+	}
+
+	slices.SortStableFunc(results, func(a, b MessageSearchResult) int {
+		if a.Rank != b.Rank {
+			if a.Rank > b.Rank {
+				return -1
+			}
+			return 1
+		}
+		return b.ReceivedAt.Compare(a.ReceivedAt)
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// parseSearchQuery splits a search query into lowercase clauses that must all match, each a
+// list of alternatives joined by OR, and terms starting with - that must not match
+func parseSearchQuery(q string) (clauses [][]string, excluded []string) {
+	or := false
+	for _, term := range SplitSearchTerms(q) {
+		switch {
+		case term == "OR":
+			or = len(clauses) > 0
+		case strings.HasPrefix(term, "-") && len(term) > 1:
+			excluded = append(excluded, strings.ToLower(term[1:]))
+		case or:
+			clauses[len(clauses)-1] = append(clauses[len(clauses)-1], strings.ToLower(term))
+			or = false
+		default:
+			clauses = append(clauses, []string{strings.ToLower(term)})
+		}
+	}
+	return clauses, excluded
+}
+
+// messageText returns the plain body of a message, or its html body without tags
+func messageText(message *Message) string {
+	if message.BodyPlain != nil {
+		return *message.BodyPlain
+	}
+	if message.BodyHTML != nil {
+		return strings.Join(strings.Fields(memoryTag.ReplaceAllString(memoryStyleBlock.ReplaceAllString(*message.BodyHTML, " "), " ")), " ")
+	}
+	return ""
+}
+
+// highlight returns the text around the first search term found in body with every term
+// wrapped in <mark> tags
+func highlight(body string, terms []string) string {
+	lower := strings.ToLower(body)
+	start := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 && (start < 0 || i < start) {
+			start = i
+		}
+	}
+	if start < 0 {
+		return ""
+	}
+
+	from, to := max(0, start-memoryHighlightRadius), min(len(body), start+memoryHighlightRadius)
+	for from > 0 && !isRuneStart(body[from]) {
+		from--
+	}
+	for to < len(body) && !isRuneStart(body[to]) {
+		to++
+	}
+	fragment := body[from:to]
+
+	var highlighted strings.Builder
+	lowerFragment := strings.ToLower(fragment)
+	for i := 0; i < len(fragment); {
+		matched := ""
+		for _, term := range terms {
+			if strings.HasPrefix(lowerFragment[i:], term) && len(term) > len(matched) {
+				matched = term
+			}
+		}
+		if matched == "" {
+			highlighted.WriteByte(fragment[i])
+			i++
+			continue
+		}
+		highlighted.WriteString("<mark>" + fragment[i:i+len(matched)] + "</mark>")
+		i += len(matched)
+	}
+
+	return strings.TrimSpace(highlighted.String())
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// Count gets the number of messages of an address and how many of them are unread
+func (s *MemoryMessageStore) Count(ctx context.Context, addressID int64) (total, unread int64, err error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	for _, message := range s.m.find(addressID, MessageFilter{}) {
+		total++
+		if message.ReadAt == nil {
+			unread++
+		}
+	}
+	return total, unread, nil
+}
+
+// GetByID gets a single message by its ID
+func (s *MemoryMessageStore) GetByID(ctx context.Context, messageID int64) (*Message, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	message, ok := s.m.messages[uint(messageID)]
+	if !ok || message.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	found := copyMessage(message)
+	return &found, nil
+}
+
+// GetRaw gets the original source of a message
+func (s *MemoryMessageStore) GetRaw(ctx context.Context, messageID int64) ([]byte, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	message, ok := s.m.messages[uint(messageID)]
+	if !ok || message.DeletedAt != nil || message.Raw == nil {
+		return nil, ErrNotFound
+	}
+	return message.Raw, nil
+}
+
+// Delete moves a message to the trash, where it stays restorable until it is purged
+func (s *MemoryMessageStore) Delete(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	message, ok := s.m.messages[uint(id)]
+	if !ok || message.DeletedAt != nil {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	message.DeletedAt = &now
+	message.UpdatedAt = now
+	return nil
+}
+
+// Restore takes a message of the address back out of the trash
+func (s *MemoryMessageStore) Restore(ctx context.Context, addressID, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	message, ok := s.m.messages[uint(id)]
+	if !ok || int64(message.ToAddressID) != addressID || message.DeletedAt == nil {
+		return ErrNotFound
+	}
+
+	message.DeletedAt = nil
+	message.UpdatedAt = time.Now()
+	return nil
+}
+
+// PurgeDeleted permanently deletes up to limit messages that were moved to the trash before
+// the given time, along with their attachments
+func (s *MemoryMessageStore) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	trashed := []*Message{}
+	for _, message := range s.m.messages {
+		if message.DeletedAt != nil && message.DeletedAt.Before(before) {
+			trashed = append(trashed, message)
+		}
+	}
+	slices.SortFunc(trashed, func(a, b *Message) int {
+		return a.DeletedAt.Compare(*b.DeletedAt)
+	})
+
+	trashed = trashed[:min(limit, len(trashed))]
+	for _, message := range trashed {
+		s.m.deleteMessage(message.ID)
+	}
+	return int64(len(trashed)), nil
+}
+
+// SetReadAt marks a message read at the given time, or unread when readAt is nil. Trashed
+// messages can't be changed and return ErrNotFound like missing ones.
+func (s *MemoryMessageStore) SetReadAt(ctx context.Context, id int64, readAt *time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	message, ok := s.m.messages[uint(id)]
+	if !ok || message.DeletedAt != nil {
+		return ErrNotFound
+	}
+
+	if readAt != nil {
+		at := *readAt
+		readAt = &at
+	}
+	message.ReadAt = readAt
+	return nil
+}
+
+// MarkAllRead marks every unread message of an address read, returning how many were updated
+func (s *MemoryMessageStore) MarkAllRead(ctx context.Context, addressID int64, readAt time.Time) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var updated int64
+	for _, message := range s.m.find(addressID, MessageFilter{Unread: true}) {
+		at := readAt
+		message.ReadAt = &at
+		message.UpdatedAt = time.Now()
+		updated++
+	}
+	return updated, nil
+}
+
+// Create stores a message together with its attachments and pending webhook deliveries
+func (s *MemoryMessageStore) Create(ctx context.Context, message *Message) error {
+	if message.Codes == nil {
+		message.Codes = []string{}
+	}
+	if message.Links == nil {
+		message.Links = []MessageLink{}
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.addresses[int64(message.ToAddressID)]; !ok {
+		return ErrNotFound
+	}
+
+	s.m.lastMessageID++
+	message.ID = s.m.lastMessageID
+	message.CreatedAt = time.Now()
+	message.UpdatedAt = message.CreatedAt
+
+	for i := range message.Attachments {
+		s.m.lastAttachmentID++
+		attachment := &message.Attachments[i]
+		attachment.ID = s.m.lastAttachmentID
+		attachment.MessageID = int64(message.ID)
+		attachment.CreatedAt = message.CreatedAt
+
+		stored := *attachment
+		s.m.attachments[stored.ID] = &stored
+	}
+
+	stored := *message
+	stored.Attachments = nil
+	s.m.messages[stored.ID] = &stored
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	s.m.enqueueDeliveries(message, payload)
+
+	return nil
+}
+
+// copyMessage returns a copy of a stored message without its raw source, like the SQL stores
+// which only load it in GetRaw
+func copyMessage(message *Message) Message {
+	found := *message
+	found.Raw = nil
+	return found
+}
@@ -0,0 +1,47 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+	"github.com/AmoabaKelvin/temp-mail/internal/store/storetest"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storetest.Run(t, func(*testing.T) *store.Storage { return store.NewMemoryStorage() })
+}
+
+func TestMemoryStorageConcurrentUse(t *testing.T) {
+	s := store.NewMemoryStorage()
+	address := storetest.CreateAddress(t, s, "busy@example.com")
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				message := &store.Message{ToAddressID: uint(address.ID), Subject: fmt.Sprintf("message %d-%d", i, j), ReceivedAt: storetest.BaseTime}
+				if err := s.Messages.Create(ctx, message); err != nil {
+					t.Errorf("Create failed: %v", err)
+					return
+				}
+				if _, err := s.Messages.List(ctx, address.ID, store.MessageFilter{Limit: 5}); err != nil {
+					t.Errorf("List failed: %v", err)
+				}
+				if err := s.Messages.SetReadAt(ctx, int64(message.ID), &storetest.BaseTime); err != nil {
+					t.Errorf("SetReadAt failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if total, unread, err := s.Messages.Count(ctx, address.ID); err != nil || total != 160 || unread != 0 {
+		t.Errorf("Count = %d, %d, %v, want 160 read messages", total, unread, err)
+	}
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+// memoryDelivery is an outbox entry of the in-memory webhook store
+type memoryDelivery struct {
+	WebhookDelivery
+	Status        string
+	NextAttemptAt time.Time
+}
+
+type MemoryWebhookStore struct {
+	m *memory
+}
+
+func (s *MemoryWebhookStore) Create(ctx context.Context, webhook *Webhook) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.addresses[webhook.AddressID]; !ok {
+		return ErrNotFound
+	}
+
+	s.m.lastWebhookID++
+	webhook.ID = s.m.lastWebhookID
+	webhook.CreatedAt = time.Now()
+
+	stored := *webhook
+	s.m.webhooks[stored.ID] = &stored
+	return nil
+}
+
+// GetByAddress gets every webhook registered for an address, without their secrets
+func (s *MemoryWebhookStore) GetByAddress(ctx context.Context, addressID int64) ([]Webhook, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	webhooks := []Webhook{}
+	for _, webhook := range s.m.webhooks {
+		if webhook.AddressID == addressID {
+			found := *webhook
+			found.Secret = ""
+			webhooks = append(webhooks, found)
+		}
+	}
+	slices.SortFunc(webhooks, func(a, b Webhook) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return webhooks, nil
+}
+
+func (s *MemoryWebhookStore) Delete(ctx context.Context, addressID, webhookID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	webhook, ok := s.m.webhooks[webhookID]
+	if !ok || webhook.AddressID != addressID {
+		return ErrNotFound
+	}
+
+	s.m.deleteWebhook(webhookID)
+	return nil
+}
+
+// deleteWebhook removes a webhook with its deliveries. The caller must hold the write lock.
+func (m *memory) deleteWebhook(id int64) {
+	for deliveryID, delivery := range m.deliveries {
+		if delivery.WebhookID == id {
+			m.deleteDelivery(deliveryID)
+		}
+	}
+	delete(m.webhooks, id)
+}
+
+// deleteDelivery removes a delivery with its attempts. The caller must hold the write lock.
+func (m *memory) deleteDelivery(id int64) {
+	m.attempts = slices.DeleteFunc(m.attempts, func(attempt WebhookAttempt) bool {
+		return attempt.DeliveryID == id
+	})
+	delete(m.deliveries, id)
+}
+
+// enqueueDeliveries adds an outbox entry for every webhook of the message's address. The
+// caller must hold the write lock.
+func (m *memory) enqueueDeliveries(message *Message, payload []byte) {
+	for _, webhook := range m.webhooks {
+		if webhook.AddressID != int64(message.ToAddressID) {
+			continue
+		}
+
+		m.lastDeliveryID++
+		m.deliveries[m.lastDeliveryID] = &memoryDelivery{
+			WebhookDelivery: WebhookDelivery{
+				ID:        m.lastDeliveryID,
+				WebhookID: webhook.ID,
+				MessageID: int64(message.ID),
+				Payload:   payload,
+			},
+			Status:        DeliveryPending,
+			NextAttemptAt: time.Now(),
+		}
+	}
+}
+
+// ClaimDue leases up to limit pending deliveries that are due, so that other dispatchers
+// skip them until the lease expires or an attempt is recorded
+func (s *MemoryWebhookStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	due := []*memoryDelivery{}
+	for _, delivery := range s.m.deliveries {
+		if delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	slices.SortFunc(due, func(a, b *memoryDelivery) int {
+		return a.NextAttemptAt.Compare(b.NextAttemptAt)
+	})
+
+	deliveries := []WebhookDelivery{}
+	for _, delivery := range due[:min(limit, len(due))] {
+		delivery.NextAttemptAt = now.Add(lease)
+
+		claimed := delivery.WebhookDelivery
+		webhook := s.m.webhooks[delivery.WebhookID]
+		claimed.URL = webhook.URL
+		claimed.Secret = webhook.Secret
+		deliveries = append(deliveries, claimed)
+	}
+
+	return deliveries, nil
+}
+
+// RecordAttempt logs an attempt and moves the delivery to the given status. Pending
+// deliveries are retried at nextAttemptAt.
+func (s *MemoryWebhookStore) RecordAttempt(ctx context.Context, attempt *WebhookAttempt, status string, nextAttemptAt time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	delivery, ok := s.m.deliveries[attempt.DeliveryID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	s.m.lastAttemptID++
+	attempt.ID = s.m.lastAttemptID
+	attempt.AttemptedAt = time.Now()
+
+	recorded := *attempt
+	recorded.MessageID = delivery.MessageID
+	s.m.attempts = append(s.m.attempts, recorded)
+
+	delivery.Status = status
+	delivery.Attempts++
+	delivery.NextAttemptAt = nextAttemptAt
+	return nil
+}
+
+// GetAttempts gets the most recent delivery attempts of a webhook, newest first
+func (s *MemoryWebhookStore) GetAttempts(ctx context.Context, webhookID int64, limit int) ([]WebhookAttempt, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	attempts := []WebhookAttempt{}
+	for i := len(s.m.attempts) - 1; i >= 0 && len(attempts) < limit; i-- {
+		attempt := s.m.attempts[i]
+		if delivery, ok := s.m.deliveries[attempt.DeliveryID]; ok && delivery.WebhookID == webhookID {
+			attempts = append(attempts, attempt)
+		}
+	}
+
+	return attempts, nil
+}
@@ -1,151 +1,126 @@
 package store
 
 import (
-	"context"
-	"database/sql"
+	"strings"
 	"time"
-
-	"github.com/AmoabaKelvin/temp-mail/internal/db"
 )
 
 type Message struct {
-	ID          uint       `json:"id"`
-	FromAddress string     `json:"from_address"`
-	ToAddressID uint       `json:"-"`
-	ToAddress   Address    `json:"-"`
-	Headers     []byte     `json:"headers"`
-	Subject     string     `json:"subject"`
-	BodyHTML    *string    `json:"body_html"`
-	BodyPlain   *string    `json:"body_plain"`
-	ContentType string     `json:"content_type"`
-	ReceivedAt  time.Time  `json:"received_at"`
-	ReadAt      time.Time  `json:"read_at"`
-	CreatedAt   time.Time  `json:"-"`
-	UpdatedAt   time.Time  `json:"-"`
-	DeletedAt   *time.Time `json:"-"`
+	ID          uint          `json:"id"`
+	FromAddress string        `json:"from_address"`
+	ToAddressID uint          `json:"-"`
+	ToAddress   Address       `json:"-"`
+	Headers     []byte        `json:"headers"`
+	Subject     string        `json:"subject"`
+	Snippet     string        `json:"snippet"`
+	BodyHTML    *string       `json:"body_html"`
+	BodyPlain   *string       `json:"body_plain"`
+	ContentType string        `json:"content_type"`
+	MIMETree    *MessagePart  `json:"mime_tree"`
+	Attachments []Attachment  `json:"attachments,omitempty"`
+	Codes       []string      `json:"codes"` // one-time codes found in the message
+	Links       []MessageLink `json:"links"` // verification, password reset and magic links
+	Raw         []byte        `json:"-"`     // original RFC 5322 source
+	ReceivedAt  time.Time     `json:"received_at"`
+	ReadAt      *time.Time    `json:"read_at"` // nil while the message is unread
+	CreatedAt   time.Time     `json:"-"`
+	UpdatedAt   time.Time     `json:"-"`
+	DeletedAt   *time.Time    `json:"-"`
 }
 
-type MessageStore struct {
-	db *db.DB
+// MessageSummary is the lightweight form of a message returned when listing an inbox
+type MessageSummary struct {
+	ID             uint          `json:"id"`
+	FromAddress    string        `json:"from_address"`
+	Subject        string        `json:"subject"`
+	Snippet        string        `json:"snippet"`
+	Codes          []string      `json:"codes"`
+	Links          []MessageLink `json:"links"`
+	ReceivedAt     time.Time     `json:"received_at"`
+	ReadAt         *time.Time    `json:"read_at"` // nil while the message is unread
+	HasAttachments bool          `json:"has_attachments"`
 }
 
-func NewMessageStore(db *db.DB) *MessageStore {
-	return &MessageStore{db: db}
+// MessageSearchResult is a message matching a search query with the matching parts highlighted
+type MessageSearchResult struct {
+	MessageSummary
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
 }
 
-// Get all messages for a given address ID
-func (s *MessageStore) Get(ctx context.Context, addressID int64) ([]Message, error) {
-	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
-	defer cancel()
-
-	query := `SELECT id, from_address, to_address_id, headers, subject, body_html, body_plain, content_type, received_at, read_at 
-			FROM messages 
-			WHERE to_address_id = $1 
-			ORDER BY received_at DESC`
-	messages := []Message{}
-	rows, err := s.db.QueryContext(ctx, query, addressID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var message Message
-		err := rows.Scan(&message.ID, &message.FromAddress, &message.ToAddressID, &message.Headers, &message.Subject, &message.BodyHTML, &message.BodyPlain, &message.ContentType, &message.ReceivedAt, &message.ReadAt)
-		if err != nil {
-			return nil, err
-		}
-		messages = append(messages, message)
-	}
-
-	return messages, nil
+// MessagePart describes a single node of a message's MIME tree
+type MessagePart struct {
+	ContentType string        `json:"content_type"`
+	Charset     string        `json:"charset,omitempty"`
+	Encoding    string        `json:"encoding,omitempty"`
+	Disposition string        `json:"disposition,omitempty"`
+	Filename    string        `json:"filename,omitempty"`
+	ContentID   string        `json:"content_id,omitempty"`
+	Size        int           `json:"size"`
+	Parts       []MessagePart `json:"parts,omitempty"`
 }
 
-func (s *MessageStore) Delete(ctx context.Context, id int64) error {
-	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
-	defer cancel()
-
-	query := `DELETE FROM messages WHERE id = $1`
-	executionResult, err := s.db.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := executionResult.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return ErrNotFound
-	}
+// Kinds of links extracted from messages
+const (
+	LinkVerification  = "verification"
+	LinkPasswordReset = "password_reset"
+	LinkMagicLink     = "magic_link"
+)
 
-	return nil
+// MessageLink is an actionable link found in a message body
+type MessageLink struct {
+	URL  string `json:"url"`
+	Kind string `json:"kind"`
+	Text string `json:"text,omitempty"`
 }
 
-func (s *MessageStore) SetReadAt(ctx context.Context, id int64, readAt *time.Time) error {
-	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
-	defer cancel()
-
-	query := `UPDATE messages SET read_at = $1 WHERE id = $2`
-	_, err := s.db.ExecContext(ctx, query, readAt, id)
-	return err
+// MessageFilter narrows down the messages returned by List and Find
+type MessageFilter struct {
+	ReceivedAfter  time.Time      // only messages received strictly after this time
+	ReceivedBefore time.Time      // only messages received strictly before this time
+	From           string         // case-insensitive substring of the sender
+	Subject        string         // case-insensitive substring of the subject
+	Unread         bool           // only messages that haven't been read
+	HasAttachments *bool          // only messages with or without attachments
+	Cursor         *MessageCursor // only messages listed after this position, used by List
+	Limit          int            // no limit when zero
 }
 
-func (s *MessageStore) Create(ctx context.Context, message *Message) error {
-	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
-	defer cancel()
-
-	query := `INSERT INTO messages (from_address, to_address_id, subject, body_html, body_plain, content_type, headers, received_at) 
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
-
-	err := s.db.QueryRowContext(ctx, query,
-		message.FromAddress,
-		message.ToAddressID,
-		message.Subject,
-		message.BodyHTML,
-		message.BodyPlain,
-		message.ContentType,
-		message.Headers,
-		message.ReceivedAt,
-	).Scan(&message.ID)
-
-	return err
+// MessageCursor is a position in the newest first ordering of an inbox
+type MessageCursor struct {
+	ReceivedAt time.Time
+	ID         uint
 }
 
-// GetByID gets a single message by its ID
-func (s *MessageStore) GetByID(ctx context.Context, messageID int64) (*Message, error) {
-	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
-	defer cancel()
+// SplitSearchTerms splits a web search style query on whitespace, keeping "quoted phrases"
+// together. Excluded terms keep their leading -.
+func SplitSearchTerms(q string) []string {
+	var terms []string
+	for {
+		q = strings.TrimSpace(q)
+		if q == "" {
+			return terms
+		}
 
-	query := `SELECT id, from_address, to_address_id, headers, subject, body_html, body_plain, content_type, received_at, read_at 
-		FROM messages 
-		WHERE id = $1`
+		prefix := ""
+		if strings.HasPrefix(q, `-"`) {
+			prefix, q = "-", q[1:]
+		}
 
-	var message Message
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		messageID,
-	).Scan(
-		&message.ID,
-		&message.FromAddress,
-		&message.ToAddressID,
-		&message.Headers,
-		&message.Subject,
-		&message.BodyHTML,
-		&message.BodyPlain,
-		&message.ContentType,
-		&message.ReceivedAt,
-		&message.ReadAt,
-	)
+		if strings.HasPrefix(q, `"`) {
+			phrase, rest, _ := strings.Cut(q[1:], `"`)
+			if phrase = strings.TrimSpace(phrase); phrase != "" {
+				terms = append(terms, prefix+phrase)
+			}
+			q = rest
+			continue
+		}
 
-	if err == sql.ErrNoRows {
-		return nil, ErrNotFound
-	}
-	if err != nil {
-		return nil, err
+		end := strings.IndexAny(q, " \t\n")
+		if end < 0 {
+			end = len(q)
+		}
+		terms = append(terms, prefix+q[:end])
+		q = q[end:]
 	}
-
-	return &message, nil
 }
@@ -0,0 +1,219 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/db"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// Error codes for a unique constraint violation
+const (
+	uniqueViolation       = "23505" // postgres
+	sqliteUniqueViolation = 2067    // SQLITE_CONSTRAINT_UNIQUE
+)
+
+// sweeperLockID is the advisory lock key held while expired addresses are purged
+const sweeperLockID = 7_466_178_227
+
+type AddressStore struct {
+	db *db.DB
+}
+
+func NewAddressStore(db *db.DB) *AddressStore {
+	return &AddressStore{db: db}
+}
+
+// Create stores a new address, returning ErrConflict when the email is already taken
+func (s *AddressStore) Create(ctx context.Context, address *store.Address) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `INSERT INTO addresses (email, token_hash, expires_at) VALUES ($1, $2, $3) RETURNING id, created_at`
+	err := s.db.QueryRowContext(ctx, query, address.Email, address.TokenHash, address.ExpiresAt).Scan(&address.ID, &address.CreatedAt)
+
+	if isUniqueViolation(err) {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (s *AddressStore) Get(ctx context.Context, email string) (*store.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT id, email, token_hash, expires_at, created_at FROM addresses WHERE email = $1`
+	address := &store.Address{}
+	err := s.db.QueryRowContext(ctx, query, email).Scan(&address.ID, &address.Email, &address.TokenHash, &address.ExpiresAt, &address.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	return address, err
+}
+
+// GetByTokenHash gets the address an access token was issued for. Tokens stop working with
+// ErrExpired once the address expires, before the sweeper gets to delete it.
+func (s *AddressStore) GetByTokenHash(ctx context.Context, tokenHash []byte) (*store.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT id, email, token_hash, expires_at, created_at FROM addresses WHERE token_hash = $1`
+	address := &store.Address{}
+	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(&address.ID, &address.Email, &address.TokenHash, &address.ExpiresAt, &address.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !address.ExpiresAt.After(time.Now()) {
+		return nil, store.ErrExpired
+	}
+	return address, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == uniqueViolation
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqliteUniqueViolation
+	}
+
+	return false
+}
+
+// SetExpiresAt moves the expiry of an address
+func (s *AddressStore) SetExpiresAt(ctx context.Context, id int64, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `UPDATE addresses SET expires_at = $1, updated_at = NOW() WHERE id = $2`
+	executionResult, err := s.db.ExecContext(ctx, query, expiresAt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := executionResult.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete permanently deletes an address along with its messages and attachments.
+// Webhooks and their deliveries are removed by the foreign key cascades.
+func (s *AddressStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM attachments WHERE message_id IN (SELECT id FROM messages WHERE to_address_id = $1)`
+	if _, err := tx.ExecContext(ctx, query, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE to_address_id = $1`, id); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM addresses WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpired permanently deletes up to limit addresses that expired before the given time,
+// along with their messages and attachments. It returns ErrLocked without deleting anything
+// when another process is purging at the same time.
+func (s *AddressStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (addresses, messages int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, sweeperLockID).Scan(&locked); err != nil {
+		return 0, 0, err
+	}
+	if !locked {
+		return 0, 0, store.ErrLocked
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM addresses WHERE expires_at < $1 ORDER BY expires_at LIMIT $2`, before, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(ids) == 0 {
+		return 0, 0, nil
+	}
+
+	query := `DELETE FROM attachments WHERE message_id IN (SELECT id FROM messages WHERE to_address_id = ANY($1))`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(ids)); err != nil {
+		return 0, 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE to_address_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, 0, err
+	}
+	if messages, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+
+	result, err = tx.ExecContext(ctx, `DELETE FROM addresses WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, 0, err
+	}
+	if addresses, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+
+	return addresses, messages, tx.Commit()
+}
@@ -0,0 +1,93 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/db"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+type AttachmentStore struct {
+	db *db.DB
+}
+
+func NewAttachmentStore(db *db.DB) *AttachmentStore {
+	return &AttachmentStore{db: db}
+}
+
+// createAttachment inserts an attachment as part of a message's transaction
+func createAttachment(ctx context.Context, tx *sql.Tx, attachment *store.Attachment) error {
+	query := `INSERT INTO attachments (message_id, filename, content_type, size, content_id, checksum, content)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+
+	return tx.QueryRowContext(ctx, query,
+		attachment.MessageID,
+		attachment.Filename,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.ContentID,
+		attachment.Checksum,
+		attachment.Content,
+	).Scan(&attachment.ID, &attachment.CreatedAt)
+}
+
+// GetByMessageID gets the metadata of every attachment of a message, without their content
+func (s *AttachmentStore) GetByMessageID(ctx context.Context, messageID int64) ([]store.Attachment, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT id, message_id, filename, content_type, size, content_id, checksum, created_at
+			FROM attachments
+			WHERE message_id = $1
+			ORDER BY id`
+	attachments := []store.Attachment{}
+	rows, err := s.db.QueryContext(ctx, query, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attachment store.Attachment
+		err := rows.Scan(&attachment.ID, &attachment.MessageID, &attachment.Filename, &attachment.ContentType, &attachment.Size, &attachment.ContentID, &attachment.Checksum, &attachment.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+// GetByID gets a single attachment of a message, including its content
+func (s *AttachmentStore) GetByID(ctx context.Context, messageID, attachmentID int64) (*store.Attachment, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT id, message_id, filename, content_type, size, content_id, checksum, content, created_at
+		FROM attachments
+		WHERE id = $1 AND message_id = $2`
+
+	var attachment store.Attachment
+	err := s.db.QueryRowContext(ctx, query, attachmentID, messageID).Scan(
+		&attachment.ID,
+		&attachment.MessageID,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.ContentID,
+		&attachment.Checksum,
+		&attachment.Content,
+		&attachment.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
@@ -0,0 +1,93 @@
+package sqlstore
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/db"
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
+	"github.com/lib/pq"
+)
+
+// channel is the Postgres NOTIFY channel events are sent on
+const channel = "tempmail_events"
+
+// PostgresBus delivers events across processes with Postgres LISTEN/NOTIFY, so the
+// API sees messages stored by the mail server. Subscribers only receive events once
+// Listen is running.
+type PostgresBus struct {
+	db    *db.DB
+	dsn   string
+	local *events.LocalBus
+}
+
+func NewPostgresBus(database *db.DB, dsn string) *PostgresBus {
+	return &PostgresBus{
+		db:    database,
+		dsn:   dsn,
+		local: events.NewLocalBus(),
+	}
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, string(payload))
+	return err
+}
+
+func (b *PostgresBus) Subscribe(addressID int64) *events.Subscription {
+	return b.local.Subscribe(addressID)
+}
+
+// Listen forwards events published by any process to local subscribers until ctx is cancelled
+func (b *PostgresBus) Listen(ctx context.Context) error {
+	listener := pq.NewListener(b.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Event listener connection error: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(channel); err != nil {
+		return err
+	}
+	log.Printf("Listening for events on channel %s", channel)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case notification := <-listener.Notify:
+			// A nil notification means the connection was re-established and
+			// events may have been missed in between
+			if notification == nil {
+				continue
+			}
+
+			var event events.Event
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				log.Printf("Ignoring malformed event %q: %v", notification.Extra, err)
+				continue
+			}
+			b.local.Publish(ctx, event)
+		case <-time.After(90 * time.Second):
+			// Make sure the connection is still alive when no events arrive
+			go listener.Ping()
+		}
+	}
+}
+
+// NewBus returns a PostgresBus for Postgres databases. SQLite can't notify other processes,
+// so it gets a LocalBus and only sees events published in the same process.
+func NewBus(database *db.DB, dsn string) events.Bus {
+	if database.Driver == db.DriverSQLite {
+		return events.NewLocalBus()
+	}
+	return NewPostgresBus(database, dsn)
+}
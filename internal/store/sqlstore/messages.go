@@ -0,0 +1,524 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/db"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+	"github.com/lib/pq"
+)
+
+// messageColumns are the columns selected for a message, in the order scanMessage reads them
+const messageColumns = `id, from_address, to_address_id, headers, subject, snippet, body_html, body_plain, content_type, mime_tree, codes, links, received_at, read_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMessage reads a row selected with messageColumns
+func scanMessage(row rowScanner) (*store.Message, error) {
+	var message store.Message
+	var mimeTree, codes, links []byte
+	err := row.Scan(
+		&message.ID,
+		&message.FromAddress,
+		&message.ToAddressID,
+		&message.Headers,
+		&message.Subject,
+		&message.Snippet,
+		&message.BodyHTML,
+		&message.BodyPlain,
+		&message.ContentType,
+		&mimeTree,
+		&codes,
+		&links,
+		&message.ReceivedAt,
+		&message.ReadAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.MIMETree, err = unmarshalMIMETree(mimeTree); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(codes, &message.Codes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(links, &message.Links); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+type MessageStore struct {
+	db *db.DB
+}
+
+func NewMessageStore(db *db.DB) *MessageStore {
+	return &MessageStore{db: db}
+}
+
+// List gets the summaries of the messages of an address matching the filter, newest first.
+// Pages after the first are fetched by passing the last summary of the previous page as
+// filter.Cursor.
+func (s *MessageStore) List(ctx context.Context, addressID int64, filter store.MessageFilter) ([]store.MessageSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT m.id, m.from_address, m.subject, m.snippet, m.codes, m.links, m.received_at, m.read_at,
+				EXISTS (SELECT 1 FROM attachments a WHERE a.message_id = m.id)
+			FROM messages m
+			WHERE m.to_address_id = $1 AND m.deleted_at IS NULL`
+	args := []any{addressID}
+
+	query, args = applyFilter(filter, query, args)
+	if filter.Cursor != nil {
+		args = append(args, filter.Cursor.ReceivedAt, filter.Cursor.ID)
+		query += fmt.Sprintf(" AND (m.received_at, m.id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	query += " ORDER BY m.received_at DESC, m.id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	summaries := []store.MessageSummary{}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var summary store.MessageSummary
+		var codes, links []byte
+		err := rows.Scan(&summary.ID, &summary.FromAddress, &summary.Subject, &summary.Snippet, &codes, &links, &summary.ReceivedAt, &summary.ReadAt, &summary.HasAttachments)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(codes, &summary.Codes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(links, &summary.Links); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, rows.Err()
+}
+
+// Search gets the messages of an address matching a web search style query such as
+// `"password reset" staging -prod`, best matches first. Matches in the body are wrapped in
+// <mark> tags in the highlight.
+func (s *MessageStore) Search(ctx context.Context, addressID int64, q string, limit int) ([]store.MessageSearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `WITH matches AS (
+				SELECT m.*, ts_rank(m.search_vector, q) AS rank, q
+				FROM messages m, websearch_to_tsquery('english', $2) q
+				WHERE m.to_address_id = $1 AND m.deleted_at IS NULL AND m.search_vector @@ q
+				ORDER BY rank DESC, m.received_at DESC
+				LIMIT $3
+			)
+			SELECT m.id, m.from_address, m.subject, m.snippet, m.codes, m.links, m.received_at, m.read_at,
+				EXISTS (SELECT 1 FROM attachments a WHERE a.message_id = m.id),
+				m.rank,
+				ts_headline('english',
+					COALESCE(m.body_plain, regexp_replace(m.body_html, '<[^>]*>', ' ', 'g'), m.subject, ''),
+					m.q, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5')
+			FROM matches m
+			ORDER BY m.rank DESC, m.received_at DESC`
+	results := []store.MessageSearchResult{}
+	rows, err := s.db.QueryContext(ctx, query, addressID, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result store.MessageSearchResult
+		var codes, links []byte
+		err := rows.Scan(
+			&result.ID,
+			&result.FromAddress,
+			&result.Subject,
+			&result.Snippet,
+			&codes,
+			&links,
+			&result.ReceivedAt,
+			&result.ReadAt,
+			&result.HasAttachments,
+			&result.Rank,
+			&result.Highlight,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(codes, &result.Codes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(links, &result.Links); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// Count gets the number of messages of an address and how many of them are unread
+func (s *MessageStore) Count(ctx context.Context, addressID int64) (total, unread int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT COUNT(*), COUNT(*) FILTER (WHERE read_at IS NULL)
+			FROM messages
+			WHERE to_address_id = $1 AND deleted_at IS NULL`
+	err = s.db.QueryRowContext(ctx, query, addressID).Scan(&total, &unread)
+	return total, unread, err
+}
+
+// applyFilter appends the conditions of the filter to a query selecting from messages m
+func applyFilter(filter store.MessageFilter, query string, args []any) (string, []any) {
+	if !filter.ReceivedAfter.IsZero() {
+		args = append(args, filter.ReceivedAfter)
+		query += fmt.Sprintf(" AND m.received_at > $%d", len(args))
+	}
+	if !filter.ReceivedBefore.IsZero() {
+		args = append(args, filter.ReceivedBefore)
+		query += fmt.Sprintf(" AND m.received_at < $%d", len(args))
+	}
+	if filter.From != "" {
+		args = append(args, filter.From)
+		query += fmt.Sprintf(" AND strpos(lower(m.from_address), lower($%d)) > 0", len(args))
+	}
+	if filter.Subject != "" {
+		args = append(args, filter.Subject)
+		query += fmt.Sprintf(" AND strpos(lower(m.subject), lower($%d)) > 0", len(args))
+	}
+	if filter.Unread {
+		query += " AND m.read_at IS NULL"
+	}
+	if filter.HasAttachments != nil {
+		condition := "EXISTS"
+		if !*filter.HasAttachments {
+			condition = "NOT EXISTS"
+		}
+		query += " AND " + condition + " (SELECT 1 FROM attachments a WHERE a.message_id = m.id)"
+	}
+	return query, args
+}
+
+// Find gets the messages of an address matching the filter, oldest first
+func (s *MessageStore) Find(ctx context.Context, addressID int64, filter store.MessageFilter) ([]store.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT ` + messageColumns + `
+			FROM messages m
+			WHERE m.to_address_id = $1 AND m.deleted_at IS NULL`
+	args := []any{addressID}
+
+	query, args = applyFilter(filter, query, args)
+
+	query += " ORDER BY m.received_at, m.id"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	messages := []store.Message{}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *message)
+	}
+
+	return messages, rows.Err()
+}
+
+// Delete moves a message to the trash, where it stays restorable until it is purged
+func (s *MessageStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `UPDATE messages SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+	executionResult, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := executionResult.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// Restore takes a message of the address back out of the trash
+func (s *MessageStore) Restore(ctx context.Context, addressID, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `UPDATE messages SET deleted_at = NULL, updated_at = NOW()
+			WHERE id = $1 AND to_address_id = $2 AND deleted_at IS NOT NULL`
+	executionResult, err := s.db.ExecContext(ctx, query, id, addressID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := executionResult.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// PurgeDeleted permanently deletes up to limit messages that were moved to the trash before
+// the given time, along with their attachments. Rows being purged by another process are
+// skipped, so several sweepers can run at once.
+func (s *MessageStore) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM messages WHERE deleted_at < $1 ORDER BY deleted_at LIMIT $2 FOR UPDATE SKIP LOCKED`, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM attachments WHERE message_id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+}
+
+// SetReadAt marks a message read at the given time, or unread when readAt is nil. Trashed
+// messages can't be changed and return ErrNotFound like missing ones.
+func (s *MessageStore) SetReadAt(ctx context.Context, id int64, readAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `UPDATE messages SET read_at = $1 WHERE id = $2 AND deleted_at IS NULL`
+	executionResult, err := s.db.ExecContext(ctx, query, readAt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := executionResult.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every unread message of an address read, returning how many were updated
+func (s *MessageStore) MarkAllRead(ctx context.Context, addressID int64, readAt time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `UPDATE messages SET read_at = $1, updated_at = NOW() WHERE to_address_id = $2 AND read_at IS NULL AND deleted_at IS NULL`
+	executionResult, err := s.db.ExecContext(ctx, query, readAt, addressID)
+	if err != nil {
+		return 0, err
+	}
+
+	return executionResult.RowsAffected()
+}
+
+// Create stores a message together with its attachments and pending webhook deliveries in a single transaction
+func (s *MessageStore) Create(ctx context.Context, message *store.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	mimeTree, err := marshalMIMETree(message.MIMETree)
+	if err != nil {
+		return err
+	}
+
+	if message.Codes == nil {
+		message.Codes = []string{}
+	}
+	codes, err := json.Marshal(message.Codes)
+	if err != nil {
+		return err
+	}
+
+	if message.Links == nil {
+		message.Links = []store.MessageLink{}
+	}
+	links, err := json.Marshal(message.Links)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO messages (from_address, to_address_id, subject, snippet, body_html, body_plain, content_type, headers, mime_tree, codes, links, raw, received_at) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`
+
+	err = tx.QueryRowContext(ctx, query,
+		message.FromAddress,
+		message.ToAddressID,
+		message.Subject,
+		message.Snippet,
+		message.BodyHTML,
+		message.BodyPlain,
+		message.ContentType,
+		message.Headers,
+		mimeTree,
+		codes,
+		links,
+		message.Raw,
+		message.ReceivedAt,
+	).Scan(&message.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range message.Attachments {
+		message.Attachments[i].MessageID = int64(message.ID)
+		if err := createAttachment(ctx, tx, &message.Attachments[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := enqueueWebhookDeliveries(ctx, tx, message); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetByID gets a single message by its ID
+func (s *MessageStore) GetByID(ctx context.Context, messageID int64) (*store.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT ` + messageColumns + `
+		FROM messages 
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	message, err := scanMessage(s.db.QueryRowContext(ctx, query, messageID))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// GetRaw gets the original source of a message, which is only loaded on demand because of its size
+func (s *MessageStore) GetRaw(ctx context.Context, messageID int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT raw FROM messages WHERE id = $1 AND deleted_at IS NULL`
+
+	var raw []byte
+	err := s.db.QueryRowContext(ctx, query, messageID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Messages stored before raw sources were kept have nothing to return
+	if raw == nil {
+		return nil, store.ErrNotFound
+	}
+
+	return raw, nil
+}
+
+// marshalMIMETree encodes a MIME tree for the mime_tree column, storing NULL when there is none
+func marshalMIMETree(tree *store.MessagePart) ([]byte, error) {
+	if tree == nil {
+		return nil, nil
+	}
+	return json.Marshal(tree)
+}
+
+// unmarshalMIMETree decodes the mime_tree column, which is NULL for messages stored before it existed
+func unmarshalMIMETree(data []byte) (*store.MessagePart, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	tree := &store.MessagePart{}
+	if err := json.Unmarshal(data, tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
@@ -0,0 +1,289 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/db"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+// The SQLite stores reuse the Postgres queries, which SQLite understands thanks to the functions
+// registered by the db package, and only replace the ones relying on Postgres features such as
+// row locks, advisory locks, arrays and tsvector. SQLite serialises writers, so the locks
+// aren't needed.
+
+type SQLiteMessageStore struct {
+	*MessageStore
+}
+
+func NewSQLiteMessageStore(db *db.DB) *SQLiteMessageStore {
+	return &SQLiteMessageStore{MessageStore: NewMessageStore(db)}
+}
+
+// Search gets the messages of an address matching a search query using the messages_fts
+// table, best matches first. Matches in the body are wrapped in <mark> tags in the highlight.
+func (s *SQLiteMessageStore) Search(ctx context.Context, addressID int64, q string, limit int) ([]store.MessageSearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	match := ftsQuery(q)
+	results := []store.MessageSearchResult{}
+	if match == "" {
+		return results, nil
+	}
+
+	query := `SELECT m.id, m.from_address, m.subject, m.snippet, m.codes, m.links, m.received_at, m.read_at,
+				EXISTS (SELECT 1 FROM attachments a WHERE a.message_id = m.id),
+				-bm25(messages_fts, 10.0, 5.0, 1.0),
+				snippet(messages_fts, 2, '<mark>', '</mark>', '…', 20)
+			FROM messages_fts
+			JOIN messages m ON m.id = messages_fts.rowid
+			WHERE messages_fts MATCH $2 AND m.to_address_id = $1 AND m.deleted_at IS NULL
+			ORDER BY bm25(messages_fts, 10.0, 5.0, 1.0), m.received_at DESC
+			LIMIT $3`
+	rows, err := s.db.QueryContext(ctx, query, addressID, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result store.MessageSearchResult
+		var codes, links []byte
+		err := rows.Scan(
+			&result.ID,
+			&result.FromAddress,
+			&result.Subject,
+			&result.Snippet,
+			&codes,
+			&links,
+			&result.ReceivedAt,
+			&result.ReadAt,
+			&result.HasAttachments,
+			&result.Rank,
+			&result.Highlight,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(codes, &result.Codes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(links, &result.Links); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// ftsQuery turns a web search style query into an FTS5 query. Every word and "quoted phrase"
+// is matched as a string so that user input can't produce a syntax error, OR is kept and
+// words starting with - are excluded.
+func ftsQuery(q string) string {
+	var terms, excluded []string
+	for _, term := range store.SplitSearchTerms(q) {
+		switch {
+		case term == "OR":
+			if len(terms) > 0 && terms[len(terms)-1] != "OR" {
+				terms = append(terms, term)
+			}
+		case strings.HasPrefix(term, "-") && len(term) > 1:
+			excluded = append(excluded, quoteFTS(term[1:]))
+		default:
+			terms = append(terms, quoteFTS(term))
+		}
+	}
+
+	if len(terms) > 0 && terms[len(terms)-1] == "OR" {
+		terms = terms[:len(terms)-1]
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+
+	query := strings.Join(terms, " ")
+	for _, term := range excluded {
+		query += " NOT " + term
+	}
+	return query
+}
+
+func quoteFTS(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+}
+
+// PurgeDeleted permanently deletes up to limit messages that were moved to the trash before
+// the given time, along with their attachments
+func (s *SQLiteMessageStore) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ids, err := selectIDs(ctx, tx, `SELECT id FROM messages WHERE deleted_at < $1 ORDER BY deleted_at LIMIT $2`, before, limit)
+	if err != nil || ids == "[]" {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM attachments WHERE message_id IN (SELECT value FROM json_each($1))`, ids); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE id IN (SELECT value FROM json_each($1))`, ids)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+}
+
+type SQLiteAddressStore struct {
+	*AddressStore
+}
+
+func NewSQLiteAddressStore(db *db.DB) *SQLiteAddressStore {
+	return &SQLiteAddressStore{AddressStore: NewAddressStore(db)}
+}
+
+// DeleteExpired permanently deletes up to limit addresses that expired before the given time,
+// along with their messages and attachments
+func (s *SQLiteAddressStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (addresses, messages int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	ids, err := selectIDs(ctx, tx, `SELECT id FROM addresses WHERE expires_at < $1 ORDER BY expires_at LIMIT $2`, before, limit)
+	if err != nil || ids == "[]" {
+		return 0, 0, err
+	}
+
+	query := `DELETE FROM attachments WHERE message_id IN (
+				SELECT id FROM messages WHERE to_address_id IN (SELECT value FROM json_each($1)))`
+	if _, err := tx.ExecContext(ctx, query, ids); err != nil {
+		return 0, 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE to_address_id IN (SELECT value FROM json_each($1))`, ids)
+	if err != nil {
+		return 0, 0, err
+	}
+	if messages, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+
+	result, err = tx.ExecContext(ctx, `DELETE FROM addresses WHERE id IN (SELECT value FROM json_each($1))`, ids)
+	if err != nil {
+		return 0, 0, err
+	}
+	if addresses, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+
+	return addresses, messages, tx.Commit()
+}
+
+type SQLiteWebhookStore struct {
+	*WebhookStore
+}
+
+func NewSQLiteWebhookStore(db *db.DB) *SQLiteWebhookStore {
+	return &SQLiteWebhookStore{WebhookStore: NewWebhookStore(db)}
+}
+
+// ClaimDue leases up to limit pending deliveries that are due, so that other dispatchers
+// skip them until the lease expires or an attempt is recorded
+func (s *SQLiteWebhookStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]store.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deliveries := []store.WebhookDelivery{}
+	now := time.Now()
+	query := `SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $2`
+	ids, err := selectIDs(ctx, tx, query, now, limit)
+	if err != nil || ids == "[]" {
+		return deliveries, err
+	}
+
+	query = `UPDATE webhook_deliveries SET next_attempt_at = $1, updated_at = $2
+			WHERE id IN (SELECT value FROM json_each($3))`
+	if _, err := tx.ExecContext(ctx, query, now.Add(lease), now, ids); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT d.id, d.webhook_id, d.message_id, w.url, w.secret, d.payload, d.attempts
+			FROM webhook_deliveries d
+			JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.id IN (SELECT value FROM json_each($1))`
+	rows, err := tx.QueryContext(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery store.WebhookDelivery
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.MessageID, &delivery.URL, &delivery.Secret, &delivery.Payload, &delivery.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, tx.Commit()
+}
+
+// selectIDs runs a query selecting ids and returns them as a JSON array, which SQLite
+// queries expand with json_each in place of Postgres arrays
+func selectIDs(ctx context.Context, tx *sql.Tx, query string, args ...any) (string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return "", err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	encoded, err := json.Marshal(ids)
+	return string(encoded), err
+}
@@ -0,0 +1,67 @@
+package sqlstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/db"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+	"github.com/AmoabaKelvin/temp-mail/internal/store/storetest"
+)
+
+// newSQLiteStorage returns storage backed by a migrated SQLite database in a temporary file
+func newSQLiteStorage(t *testing.T) *store.Storage {
+	t.Helper()
+
+	database, err := db.New("sqlite:" + filepath.Join(t.TempDir(), "mail.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if err := database.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return NewStorage(database)
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	storetest.Run(t, newSQLiteStorage)
+}
+
+func TestFTSQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"hello", `"hello"`},
+		{"hello world", `"hello" "world"`},
+		{`"password reset" staging -prod`, `"password reset" "staging" NOT "prod"`},
+		{`-"two words" x`, `"x" NOT "two words"`},
+		{"a OR b", `"a" OR "b"`},
+		{"a or b", `"a" "or" "b"`},
+		{"OR a", `"a"`},
+		{"a OR", `"a"`},
+		{"a OR OR b", `"a" OR "b"`},
+		{"a OR -b", `"a" NOT "b"`},
+		{"-a", ""},
+		{"-a -b", ""},
+		{"-", `"-"`},
+		{`say "hi`, `"say" "hi"`},
+		{`""`, ""},
+		{`a"b`, `"a""b"`},
+		{"subject:foo", `"subject:foo"`},
+		{"NEAR(a b)", `"NEAR(a" "b)"`},
+		{"prod*", `"prod*"`},
+		{"AND NOT", `"AND" "NOT"`},
+	}
+
+	for _, tt := range tests {
+		if got := ftsQuery(tt.q); got != tt.want {
+			t.Errorf("ftsQuery(%q) = %s, want %s", tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// Package sqlstore implements store.Storage on Postgres and SQLite databases.
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/db"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+// QueryDurationTimeout is the default timeout for queries
+var QueryDurationTimeout = 5 * time.Second
+
+// NewStorage returns the stores for the database, using the SQLite variants for SQLite databases
+func NewStorage(database *db.DB) *store.Storage {
+	if database.Driver == db.DriverSQLite {
+		return &store.Storage{
+			Messages:    NewSQLiteMessageStore(database),
+			Addresses:   NewSQLiteAddressStore(database),
+			Attachments: NewAttachmentStore(database),
+			Webhooks:    NewSQLiteWebhookStore(database),
+		}
+	}
+
+	return &store.Storage{
+		Messages:    NewMessageStore(database),
+		Addresses:   NewAddressStore(database),
+		Attachments: NewAttachmentStore(database),
+		Webhooks:    NewWebhookStore(database),
+	}
+}
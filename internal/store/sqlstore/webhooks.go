@@ -0,0 +1,188 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/db"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+type WebhookStore struct {
+	db *db.DB
+}
+
+func NewWebhookStore(db *db.DB) *WebhookStore {
+	return &WebhookStore{db: db}
+}
+
+func (s *WebhookStore) Create(ctx context.Context, webhook *store.Webhook) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `INSERT INTO webhooks (address_id, url, secret) VALUES ($1, $2, $3) RETURNING id, created_at`
+	return s.db.QueryRowContext(ctx, query, webhook.AddressID, webhook.URL, webhook.Secret).Scan(&webhook.ID, &webhook.CreatedAt)
+}
+
+// GetByAddress gets every webhook registered for an address, without their secrets
+func (s *WebhookStore) GetByAddress(ctx context.Context, addressID int64) ([]store.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT id, address_id, url, created_at FROM webhooks WHERE address_id = $1 ORDER BY id`
+	webhooks := []store.Webhook{}
+	rows, err := s.db.QueryContext(ctx, query, addressID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var webhook store.Webhook
+		if err := rows.Scan(&webhook.ID, &webhook.AddressID, &webhook.URL, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (s *WebhookStore) Delete(ctx context.Context, addressID, webhookID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `DELETE FROM webhooks WHERE id = $1 AND address_id = $2`
+	executionResult, err := s.db.ExecContext(ctx, query, webhookID, addressID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := executionResult.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// enqueueWebhookDeliveries adds an outbox entry for every webhook of the message's address,
+// as part of the transaction that stores the message
+func enqueueWebhookDeliveries(ctx context.Context, tx *sql.Tx, message *store.Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO webhook_deliveries (webhook_id, message_id, payload)
+			SELECT id, $2, $3 FROM webhooks WHERE address_id = $1`
+	_, err = tx.ExecContext(ctx, query, message.ToAddressID, message.ID, payload)
+	return err
+}
+
+// ClaimDue leases up to limit pending deliveries that are due, so that other dispatchers
+// skip them until the lease expires or an attempt is recorded
+func (s *WebhookStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]store.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `WITH due AS (
+				SELECT id FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			), claimed AS (
+				UPDATE webhook_deliveries d
+				SET next_attempt_at = NOW() + $2 * INTERVAL '1 second', updated_at = NOW()
+				FROM due
+				WHERE d.id = due.id
+				RETURNING d.id, d.webhook_id, d.message_id, d.payload, d.attempts
+			)
+			SELECT c.id, c.webhook_id, c.message_id, w.url, w.secret, c.payload, c.attempts
+			FROM claimed c
+			JOIN webhooks w ON w.id = c.webhook_id`
+
+	deliveries := []store.WebhookDelivery{}
+	rows, err := s.db.QueryContext(ctx, query, limit, int64(lease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery store.WebhookDelivery
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.MessageID, &delivery.URL, &delivery.Secret, &delivery.Payload, &delivery.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordAttempt logs an attempt and moves the delivery to the given status. Pending
+// deliveries are retried at nextAttemptAt.
+func (s *WebhookStore) RecordAttempt(ctx context.Context, attempt *store.WebhookAttempt, status string, nextAttemptAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO webhook_attempts (delivery_id, status_code, error, duration_ms)
+			VALUES ($1, $2, $3, $4) RETURNING id, attempted_at`
+	err = tx.QueryRowContext(ctx, query, attempt.DeliveryID, attempt.StatusCode, attempt.Error, attempt.Duration).Scan(&attempt.ID, &attempt.AttemptedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE webhook_deliveries
+			SET status = $1, attempts = attempts + 1, next_attempt_at = $2, updated_at = NOW()
+			WHERE id = $3`
+	if _, err := tx.ExecContext(ctx, query, status, nextAttemptAt, attempt.DeliveryID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAttempts gets the most recent delivery attempts of a webhook, newest first
+func (s *WebhookStore) GetAttempts(ctx context.Context, webhookID int64, limit int) ([]store.WebhookAttempt, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDurationTimeout)
+	defer cancel()
+
+	query := `SELECT a.id, a.delivery_id, d.message_id, a.status_code, a.error, a.duration_ms, a.attempted_at
+			FROM webhook_attempts a
+			JOIN webhook_deliveries d ON d.id = a.delivery_id
+			WHERE d.webhook_id = $1
+			ORDER BY a.attempted_at DESC, a.id DESC
+			LIMIT $2`
+	attempts := []store.WebhookAttempt{}
+	rows, err := s.db.QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attempt store.WebhookAttempt
+		err := rows.Scan(&attempt.ID, &attempt.DeliveryID, &attempt.MessageID, &attempt.StatusCode, &attempt.Error, &attempt.Duration, &attempt.AttemptedAt)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, rows.Err()
+}
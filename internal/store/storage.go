@@ -4,32 +4,48 @@ import (
 	"context"
 	"errors"
 	"time"
-
-	"github.com/AmoabaKelvin/temp-mail/internal/db"
 )
 
 var (
-	ErrNotFound          = errors.New("record not found")
-	QueryDurationTimeout = 5 * time.Second // default timeout for queries
+	ErrNotFound = errors.New("record not found")
+	ErrLocked   = errors.New("record locked by another process")
+	ErrConflict = errors.New("record already exists")
+	ErrExpired  = errors.New("record expired")
 )
 
 type Storage struct {
 	Messages interface {
-		Get(context.Context, int64) ([]Message, error)
+		List(context.Context, int64, MessageFilter) ([]MessageSummary, error)
+		Find(context.Context, int64, MessageFilter) ([]Message, error)
+		Search(context.Context, int64, string, int) ([]MessageSearchResult, error)
+		Count(context.Context, int64) (int64, int64, error)
 		GetByID(context.Context, int64) (*Message, error)
+		GetRaw(context.Context, int64) ([]byte, error)
 		Delete(context.Context, int64) error
+		Restore(context.Context, int64, int64) error
+		PurgeDeleted(context.Context, time.Time, int) (int64, error)
 		SetReadAt(context.Context, int64, *time.Time) error
+		MarkAllRead(context.Context, int64, time.Time) (int64, error)
 		Create(context.Context, *Message) error
 	}
 	Addresses interface {
 		Create(context.Context, *Address) error
 		Get(context.Context, string) (*Address, error)
+		GetByTokenHash(context.Context, []byte) (*Address, error)
+		SetExpiresAt(context.Context, int64, time.Time) error
+		Delete(context.Context, int64) error
+		DeleteExpired(context.Context, time.Time, int) (int64, int64, error)
 	}
-}
-
-func NewStorage(db *db.DB) *Storage {
-	return &Storage{
-		Messages:  NewMessageStore(db),
-		Addresses: NewAddressStore(db),
+	Attachments interface {
+		GetByMessageID(context.Context, int64) ([]Attachment, error)
+		GetByID(context.Context, int64, int64) (*Attachment, error)
+	}
+	Webhooks interface {
+		Create(context.Context, *Webhook) error
+		GetByAddress(context.Context, int64) ([]Webhook, error)
+		Delete(context.Context, int64, int64) error
+		ClaimDue(context.Context, int, time.Duration) ([]WebhookDelivery, error)
+		RecordAttempt(context.Context, *WebhookAttempt, string, time.Time) error
+		GetAttempts(context.Context, int64, int) ([]WebhookAttempt, error)
 	}
 }
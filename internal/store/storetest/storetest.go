@@ -0,0 +1,622 @@
+// Package storetest holds the behaviour every store.Storage implementation has to share, run
+// by the tests of each backend.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+// Run runs the shared behaviour as subtests of t, each against fresh storage from newStorage
+func Run(t *testing.T, newStorage func(t *testing.T) *store.Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s *store.Storage)
+	}{
+		{"addresses", testAddresses},
+		{"list paging", testListPaging},
+		{"filters", testFilters},
+		{"search", testSearch},
+		{"extracted codes and links", testExtracted},
+		{"trash", testTrash},
+		{"read state", testReadState},
+		{"expiry", testExpiry},
+		{"webhooks", testWebhooks},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+// BaseTime is a fixed time with no sub-second part, which every backend stores exactly
+var BaseTime = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+// CreateAddress creates an address expiring an hour from now, so its token works
+func CreateAddress(t *testing.T, s *store.Storage, email string) *store.Address {
+	t.Helper()
+
+	address := &store.Address{
+		Email:     email,
+		TokenHash: []byte("hash of " + email),
+		ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+	if err := s.Addresses.Create(context.Background(), address); err != nil {
+		t.Fatalf("failed to create address %s: %v", email, err)
+	}
+	return address
+}
+
+// MessageOption changes a message before CreateMessage stores it
+type MessageOption func(*store.Message)
+
+func withAttachment(filename string) MessageOption {
+	return func(m *store.Message) {
+		m.Attachments = append(m.Attachments, store.Attachment{
+			Filename:    filename,
+			ContentType: "application/octet-stream",
+			Size:        4,
+			Checksum:    "checksum",
+			Content:     []byte("data"),
+		})
+	}
+}
+
+func from(sender string) MessageOption {
+	return func(m *store.Message) { m.FromAddress = sender }
+}
+
+func body(plain string) MessageOption {
+	return func(m *store.Message) { m.BodyPlain = &plain }
+}
+
+func extracted(codes []string, links []store.MessageLink) MessageOption {
+	return func(m *store.Message) { m.Codes, m.Links = codes, links }
+}
+
+// CreateMessage stores a plain text message to address
+func CreateMessage(t *testing.T, s *store.Storage, address *store.Address, subject string, receivedAt time.Time, options ...MessageOption) *store.Message {
+	t.Helper()
+
+	plain := "Body of " + subject
+	message := &store.Message{
+		FromAddress: "sender@example.com",
+		ToAddressID: uint(address.ID),
+		Subject:     subject,
+		Snippet:     subject,
+		BodyPlain:   &plain,
+		ContentType: "text/plain",
+		Headers:     []byte(`{}`),
+		Raw:         []byte("Subject: " + subject + "\r\n\r\n" + plain),
+		ReceivedAt:  receivedAt,
+	}
+	for _, option := range options {
+		option(message)
+	}
+	if err := s.Messages.Create(context.Background(), message); err != nil {
+		t.Fatalf("failed to create message %q: %v", subject, err)
+	}
+	return message
+}
+
+func subjects[T any](items []T, subject func(T) string) []string {
+	result := []string{}
+	for _, item := range items {
+		result = append(result, subject(item))
+	}
+	return result
+}
+
+func summarySubjects(summaries []store.MessageSummary) []string {
+	return subjects(summaries, func(s store.MessageSummary) string { return s.Subject })
+}
+
+func searchSubjects(results []store.MessageSearchResult) []string {
+	return subjects(results, func(r store.MessageSearchResult) string { return r.Subject })
+}
+
+func testAddresses(t *testing.T, s *store.Storage) {
+	ctx := context.Background()
+	address := CreateAddress(t, s, "one@example.com")
+	if address.ID == 0 || address.CreatedAt.IsZero() {
+		t.Errorf("created address has ID %d and created_at %s, want both set", address.ID, address.CreatedAt)
+	}
+
+	err := s.Addresses.Create(ctx, &store.Address{Email: "one@example.com", TokenHash: []byte("other"), ExpiresAt: BaseTime})
+	if !errors.Is(err, store.ErrConflict) {
+		t.Errorf("creating a taken address returned %v, want %v", err, store.ErrConflict)
+	}
+
+	got, err := s.Addresses.Get(ctx, "one@example.com")
+	if err != nil || got.ID != address.ID || !got.ExpiresAt.Equal(address.ExpiresAt) {
+		t.Errorf("Get returned %+v, %v, want address %d expiring at %s", got, err, address.ID, address.ExpiresAt)
+	}
+	if got, err := s.Addresses.GetByTokenHash(ctx, address.TokenHash); err != nil || got.ID != address.ID {
+		t.Errorf("GetByTokenHash returned %+v, %v, want address %d", got, err, address.ID)
+	}
+	if _, err := s.Addresses.Get(ctx, "missing@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get of a missing address returned %v, want %v", err, store.ErrNotFound)
+	}
+	if _, err := s.Addresses.GetByTokenHash(ctx, []byte("wrong")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetByTokenHash with a wrong hash returned %v, want %v", err, store.ErrNotFound)
+	}
+
+	expired := CreateAddress(t, s, "expired@example.com")
+	if err := s.Addresses.SetExpiresAt(ctx, expired.ID, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("SetExpiresAt failed: %v", err)
+	}
+	if _, err := s.Addresses.GetByTokenHash(ctx, expired.TokenHash); !errors.Is(err, store.ErrExpired) {
+		t.Errorf("GetByTokenHash of an expired address returned %v, want %v", err, store.ErrExpired)
+	}
+
+	expiresAt := BaseTime.Add(24 * time.Hour)
+	if err := s.Addresses.SetExpiresAt(ctx, address.ID, expiresAt); err != nil {
+		t.Fatalf("SetExpiresAt failed: %v", err)
+	}
+	if got, _ := s.Addresses.Get(ctx, address.Email); !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("address expires at %s after SetExpiresAt, want %s", got.ExpiresAt, expiresAt)
+	}
+	if err := s.Addresses.SetExpiresAt(ctx, address.ID+100, expiresAt); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("SetExpiresAt of a missing address returned %v, want %v", err, store.ErrNotFound)
+	}
+
+	CreateMessage(t, s, address, "hello", BaseTime)
+	if err := s.Addresses.Delete(ctx, address.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := s.Addresses.Get(ctx, address.Email); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get after Delete returned %v, want %v", err, store.ErrNotFound)
+	}
+	if err := s.Addresses.Delete(ctx, address.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleting twice returned %v, want %v", err, store.ErrNotFound)
+	}
+
+	// The email can be reused once the address is gone
+	CreateAddress(t, s, "one@example.com")
+}
+
+func testListPaging(t *testing.T, s *store.Storage) {
+	ctx := context.Background()
+	address := CreateAddress(t, s, "paging@example.com")
+	other := CreateAddress(t, s, "other@example.com")
+
+	// m2 and m3 share a timestamp, so the cursor has to fall back to the ID
+	CreateMessage(t, s, address, "m1", BaseTime)
+	CreateMessage(t, s, address, "m2", BaseTime.Add(time.Minute))
+	CreateMessage(t, s, address, "m3", BaseTime.Add(time.Minute))
+	CreateMessage(t, s, address, "m4", BaseTime.Add(2*time.Minute))
+	CreateMessage(t, s, address, "m5", BaseTime.Add(3*time.Minute))
+	CreateMessage(t, s, other, "not mine", BaseTime.Add(time.Minute))
+
+	var pages [][]string
+	filter := store.MessageFilter{Limit: 2}
+	for {
+		page, err := s.Messages.List(ctx, address.ID, filter)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, summarySubjects(page))
+
+		last := page[len(page)-1]
+		filter.Cursor = &store.MessageCursor{ReceivedAt: last.ReceivedAt, ID: last.ID}
+		if len(pages) > 5 {
+			t.Fatalf("paging doesn't end: %q", pages)
+		}
+	}
+
+	want := [][]string{{"m5", "m4"}, {"m3", "m2"}, {"m1"}}
+	if !slices.EqualFunc(pages, want, slices.Equal) {
+		t.Errorf("pages = %q, want %q", pages, want)
+	}
+
+	all, err := s.Messages.Find(ctx, address.ID, store.MessageFilter{})
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if got := subjects(all, func(m store.Message) string { return m.Subject }); !slices.Equal(got, []string{"m1", "m2", "m3", "m4", "m5"}) {
+		t.Errorf("Find returned %q, want every message oldest first", got)
+	}
+}
+
+func testFilters(t *testing.T, s *store.Storage) {
+	ctx := context.Background()
+	address := CreateAddress(t, s, "filters@example.com")
+
+	CreateMessage(t, s, address, "Welcome aboard", BaseTime, from("hello@Service.com"))
+	invoice := CreateMessage(t, s, address, "Your invoice", BaseTime.Add(time.Minute), withAttachment("invoice.pdf"))
+	CreateMessage(t, s, address, "Reset your password", BaseTime.Add(2*time.Minute), from("no-reply@service.com"))
+
+	if err := s.Messages.SetReadAt(ctx, int64(invoice.ID), &BaseTime); err != nil {
+		t.Fatalf("SetReadAt failed: %v", err)
+	}
+
+	yes, no := true, false
+	tests := []struct {
+		name   string
+		filter store.MessageFilter
+		want   []string
+	}{
+		{"everything", store.MessageFilter{}, []string{"Reset your password", "Your invoice", "Welcome aboard"}},
+		{"received after", store.MessageFilter{ReceivedAfter: BaseTime}, []string{"Reset your password", "Your invoice"}},
+		{"received before", store.MessageFilter{ReceivedBefore: BaseTime.Add(2 * time.Minute)}, []string{"Your invoice", "Welcome aboard"}},
+		{"sender ignores case", store.MessageFilter{From: "SERVICE.COM"}, []string{"Reset your password", "Welcome aboard"}},
+		{"subject ignores case", store.MessageFilter{Subject: "YOUR"}, []string{"Reset your password", "Your invoice"}},
+		{"unread", store.MessageFilter{Unread: true}, []string{"Reset your password", "Welcome aboard"}},
+		{"with attachments", store.MessageFilter{HasAttachments: &yes}, []string{"Your invoice"}},
+		{"without attachments", store.MessageFilter{HasAttachments: &no}, []string{"Reset your password", "Welcome aboard"}},
+		{"limit", store.MessageFilter{Limit: 1}, []string{"Reset your password"}},
+		{"combined", store.MessageFilter{From: "service", Unread: true, ReceivedBefore: BaseTime.Add(time.Minute)}, []string{"Welcome aboard"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summaries, err := s.Messages.List(ctx, address.ID, tt.filter)
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			if got := summarySubjects(summaries); !slices.Equal(got, tt.want) {
+				t.Errorf("List returned %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	summaries, _ := s.Messages.List(ctx, address.ID, store.MessageFilter{HasAttachments: &yes})
+	if len(summaries) != 1 || !summaries[0].HasAttachments || summaries[0].ReadAt == nil {
+		t.Errorf("invoice summary = %+v, want it read and with attachments", summaries)
+	}
+}
+
+func testSearch(t *testing.T, s *store.Storage) {
+	ctx := context.Background()
+	address := CreateAddress(t, s, "search@example.com")
+	other := CreateAddress(t, s, "other@example.com")
+
+	CreateMessage(t, s, address, "Password reset", BaseTime, body("Click the link to reset your password on staging."))
+	CreateMessage(t, s, address, "Welcome", BaseTime.Add(time.Minute), body("Thanks for signing up, your account on prod is ready."))
+	CreateMessage(t, s, address, "Invoice", BaseTime.Add(2*time.Minute), body("Your invoice for staging and prod is attached."))
+	deleted := CreateMessage(t, s, address, "Old password reset", BaseTime.Add(3*time.Minute), body("An old reset link."))
+	CreateMessage(t, s, other, "Password reset", BaseTime, body("Someone else's reset."))
+
+	if err := s.Messages.Delete(ctx, int64(deleted.ID)); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"invoice", []string{"Invoice"}},
+		{"PASSWORD", []string{"Password reset"}},
+		{`"reset your password"`, []string{"Password reset"}},
+		{`"password staging"`, []string{}},
+		{"staging", []string{"Invoice", "Password reset"}},
+		{"staging -invoice", []string{"Password reset"}},
+		{`staging -"your invoice"`, []string{"Password reset"}},
+		{"welcome OR invoice", []string{"Invoice", "Welcome"}},
+		{"OR welcome", []string{"Welcome"}},
+		{"welcome OR", []string{"Welcome"}},
+		{"nothing matches this", []string{}},
+		{"-staging", []string{}},
+		{"", []string{}},
+		{`"`, []string{}},
+		{`unbalanced "quote`, []string{}},
+		{"NEAR(staging prod)", []string{}},
+		{"subject:welcome", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := s.Messages.Search(ctx, address.ID, tt.query, 10)
+			if err != nil {
+				t.Fatalf("Search(%q) failed: %v", tt.query, err)
+			}
+
+			got := searchSubjects(results)
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) returned %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	// Subject matches rank above body matches
+	results, err := s.Messages.Search(ctx, address.ID, "password", 10)
+	if err != nil || len(results) != 1 || results[0].Rank <= 0 {
+		t.Fatalf("Search(password) returned %+v, %v, want one ranked result", results, err)
+	}
+	results, err = s.Messages.Search(ctx, address.ID, "invoice OR password", 1)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Search with a limit of 1 returned %d results, %v", len(results), err)
+	}
+	if !strings.Contains(results[0].Highlight, "<mark>") {
+		t.Errorf("highlight %q has no <mark>", results[0].Highlight)
+	}
+}
+
+// testExtracted checks that the codes and links of a message come back from every way of
+// listing messages
+func testExtracted(t *testing.T, s *store.Storage) {
+	ctx := context.Background()
+	address := CreateAddress(t, s, "extracted@example.com")
+	codes := []string{"123456"}
+	links := []store.MessageLink{{URL: "https://example.com/verify?token=abc", Kind: "verification", Text: "Verify your email"}}
+	CreateMessage(t, s, address, "Verify your email", BaseTime, extracted(codes, links))
+	CreateMessage(t, s, address, "Plain", BaseTime.Add(time.Minute))
+
+	summaries, err := s.Messages.List(ctx, address.ID, store.MessageFilter{})
+	if err != nil || len(summaries) != 2 {
+		t.Fatalf("List returned %d summaries, %v, want 2", len(summaries), err)
+	}
+	if summaries[0].Codes == nil || summaries[0].Links == nil || len(summaries[0].Codes) != 0 || len(summaries[0].Links) != 0 {
+		t.Errorf("List returned codes %v and links %v for a message without any, want empty lists", summaries[0].Codes, summaries[0].Links)
+	}
+	if !slices.Equal(summaries[1].Codes, codes) || !slices.Equal(summaries[1].Links, links) {
+		t.Errorf("List returned codes %v and links %+v, want %v and %+v", summaries[1].Codes, summaries[1].Links, codes, links)
+	}
+
+	results, err := s.Messages.Search(ctx, address.ID, "verify", 10)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Search returned %d results, %v, want 1", len(results), err)
+	}
+	if !slices.Equal(results[0].Codes, codes) || !slices.Equal(results[0].Links, links) {
+		t.Errorf("Search returned codes %v and links %+v, want %v and %+v", results[0].Codes, results[0].Links, codes, links)
+	}
+
+	messages, err := s.Messages.Find(ctx, address.ID, store.MessageFilter{ReceivedBefore: BaseTime.Add(time.Second)})
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("Find returned %d messages, %v, want 1", len(messages), err)
+	}
+	if !slices.Equal(messages[0].Codes, codes) || !slices.Equal(messages[0].Links, links) {
+		t.Errorf("Find returned codes %v and links %+v, want %v and %+v", messages[0].Codes, messages[0].Links, codes, links)
+	}
+}
+
+func testTrash(t *testing.T, s *store.Storage) {
+	ctx := context.Background()
+	address := CreateAddress(t, s, "trash@example.com")
+	other := CreateAddress(t, s, "other@example.com")
+
+	kept := CreateMessage(t, s, address, "kept", BaseTime)
+	message := CreateMessage(t, s, address, "trashed", BaseTime.Add(time.Minute), withAttachment("a.txt"))
+	id := int64(message.ID)
+	attachmentID := message.Attachments[0].ID
+
+	if err := s.Messages.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := s.Messages.GetByID(ctx, id); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetByID of a trashed message returned %v, want %v", err, store.ErrNotFound)
+	}
+	if _, err := s.Messages.GetRaw(ctx, id); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetRaw of a trashed message returned %v, want %v", err, store.ErrNotFound)
+	}
+	if summaries, _ := s.Messages.List(ctx, address.ID, store.MessageFilter{}); !slices.Equal(summarySubjects(summaries), []string{"kept"}) {
+		t.Errorf("List returned %q with a message in the trash, want only kept", summarySubjects(summaries))
+	}
+	if total, _, _ := s.Messages.Count(ctx, address.ID); total != 1 {
+		t.Errorf("Count = %d with a message in the trash, want 1", total)
+	}
+	if err := s.Messages.Delete(ctx, id); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleting a trashed message returned %v, want %v", err, store.ErrNotFound)
+	}
+
+	if err := s.Messages.Restore(ctx, other.ID, id); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("restoring another address's message returned %v, want %v", err, store.ErrNotFound)
+	}
+	if err := s.Messages.Restore(ctx, address.ID, int64(kept.ID)); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("restoring a message that isn't in the trash returned %v, want %v", err, store.ErrNotFound)
+	}
+	if err := s.Messages.Restore(ctx, address.ID, id); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got, err := s.Messages.GetByID(ctx, id); err != nil || got.Subject != "trashed" {
+		t.Errorf("GetByID after Restore returned %+v, %v", got, err)
+	}
+
+	// Only messages trashed before the cutoff are purged
+	if err := s.Messages.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if purged, err := s.Messages.PurgeDeleted(ctx, time.Now().Add(-time.Hour), 10); err != nil || purged != 0 {
+		t.Errorf("PurgeDeleted before the deletion purged %d, %v, want 0", purged, err)
+	}
+	if purged, err := s.Messages.PurgeDeleted(ctx, time.Now().Add(time.Hour), 10); err != nil || purged != 1 {
+		t.Errorf("PurgeDeleted purged %d, %v, want 1", purged, err)
+	}
+	if err := s.Messages.Restore(ctx, address.ID, id); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("restoring a purged message returned %v, want %v", err, store.ErrNotFound)
+	}
+	if _, err := s.Attachments.GetByID(ctx, id, attachmentID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetByID of a purged attachment returned %v, want %v", err, store.ErrNotFound)
+	}
+	if _, err := s.Messages.GetByID(ctx, int64(kept.ID)); err != nil {
+		t.Errorf("GetByID of the kept message returned %v", err)
+	}
+}
+
+func testReadState(t *testing.T, s *store.Storage) {
+	ctx := context.Background()
+	address := CreateAddress(t, s, "read@example.com")
+
+	first := CreateMessage(t, s, address, "first", BaseTime)
+	CreateMessage(t, s, address, "second", BaseTime.Add(time.Minute))
+	CreateMessage(t, s, address, "third", BaseTime.Add(2*time.Minute))
+
+	message, err := s.Messages.GetByID(ctx, int64(first.ID))
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if message.ReadAt != nil {
+		t.Errorf("new message has read_at %v, want it unread", message.ReadAt)
+	}
+
+	readAt := BaseTime.Add(time.Hour)
+	if err := s.Messages.SetReadAt(ctx, int64(first.ID), &readAt); err != nil {
+		t.Fatalf("SetReadAt failed: %v", err)
+	}
+	message, _ = s.Messages.GetByID(ctx, int64(first.ID))
+	if message.ReadAt == nil || !message.ReadAt.Equal(readAt) {
+		t.Errorf("message has read_at %v, want it read at %s", message.ReadAt, readAt)
+	}
+	if total, unread, err := s.Messages.Count(ctx, address.ID); err != nil || total != 3 || unread != 2 {
+		t.Errorf("Count = %d, %d, %v, want 3 messages with 2 unread", total, unread, err)
+	}
+
+	if err := s.Messages.SetReadAt(ctx, int64(first.ID), nil); err != nil {
+		t.Fatalf("SetReadAt(nil) failed: %v", err)
+	}
+	if message, _ := s.Messages.GetByID(ctx, int64(first.ID)); message.ReadAt != nil {
+		t.Errorf("message is still read after SetReadAt(nil)")
+	}
+
+	if updated, err := s.Messages.MarkAllRead(ctx, address.ID, readAt); err != nil || updated != 3 {
+		t.Errorf("MarkAllRead updated %d, %v, want 3", updated, err)
+	}
+	if updated, err := s.Messages.MarkAllRead(ctx, address.ID, readAt); err != nil || updated != 0 {
+		t.Errorf("second MarkAllRead updated %d, %v, want 0", updated, err)
+	}
+	if _, unread, _ := s.Messages.Count(ctx, address.ID); unread != 0 {
+		t.Errorf("%d unread after MarkAllRead, want 0", unread)
+	}
+
+	if err := s.Messages.SetReadAt(ctx, 9999, &readAt); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("SetReadAt of a missing message returned %v, want %v", err, store.ErrNotFound)
+	}
+	if err := s.Messages.Delete(ctx, int64(first.ID)); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := s.Messages.SetReadAt(ctx, int64(first.ID), nil); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("SetReadAt of a trashed message returned %v, want %v", err, store.ErrNotFound)
+	}
+}
+
+func testExpiry(t *testing.T, s *store.Storage) {
+	ctx := context.Background()
+	expired := CreateAddress(t, s, "expired@example.com")
+	alive := CreateAddress(t, s, "alive@example.com")
+	if err := s.Addresses.SetExpiresAt(ctx, expired.ID, BaseTime.Add(-time.Minute)); err != nil {
+		t.Fatalf("SetExpiresAt failed: %v", err)
+	}
+
+	webhook := &store.Webhook{AddressID: expired.ID, URL: "https://hooks.example.com/", Secret: "secret"}
+	if err := s.Webhooks.Create(ctx, webhook); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+
+	var expiredMessages []*store.Message
+	for i := range 3 {
+		expiredMessages = append(expiredMessages, CreateMessage(t, s, expired, fmt.Sprintf("expired %d", i), BaseTime, withAttachment("a.bin")))
+	}
+	kept := CreateMessage(t, s, alive, "kept", BaseTime, withAttachment("b.bin"))
+
+	addresses, messages, err := s.Addresses.DeleteExpired(ctx, BaseTime, 10)
+	if err != nil || addresses != 1 || messages != 3 {
+		t.Fatalf("DeleteExpired returned %d addresses and %d messages, %v, want 1 and 3", addresses, messages, err)
+	}
+
+	if _, err := s.Addresses.Get(ctx, expired.Email); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get of an expired address returned %v, want %v", err, store.ErrNotFound)
+	}
+	for _, message := range expiredMessages {
+		if _, err := s.Messages.GetByID(ctx, int64(message.ID)); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("GetByID of message %d of an expired address returned %v, want %v", message.ID, err, store.ErrNotFound)
+		}
+		if _, err := s.Attachments.GetByID(ctx, int64(message.ID), message.Attachments[0].ID); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("attachment of message %d survived the expiry: %v", message.ID, err)
+		}
+	}
+	if webhooks, err := s.Webhooks.GetByAddress(ctx, expired.ID); err != nil || len(webhooks) != 0 {
+		t.Errorf("GetByAddress returned %d webhooks, %v, want none left", len(webhooks), err)
+	}
+	if deliveries, err := s.Webhooks.ClaimDue(ctx, 10, time.Minute); err != nil || len(deliveries) != 0 {
+		t.Errorf("ClaimDue returned %d deliveries, %v, want none left", len(deliveries), err)
+	}
+
+	if _, err := s.Addresses.Get(ctx, alive.Email); err != nil {
+		t.Errorf("Get of a live address returned %v", err)
+	}
+	if attachment, err := s.Attachments.GetByID(ctx, int64(kept.ID), kept.Attachments[0].ID); err != nil || string(attachment.Content) != "data" {
+		t.Errorf("attachment of a live address = %+v, %v", attachment, err)
+	}
+
+	if addresses, messages, err := s.Addresses.DeleteExpired(ctx, BaseTime, 10); err != nil || addresses != 0 || messages != 0 {
+		t.Errorf("second DeleteExpired returned %d, %d, %v, want nothing left to delete", addresses, messages, err)
+	}
+}
+
+func testWebhooks(t *testing.T, s *store.Storage) {
+	ctx := context.Background()
+	address := CreateAddress(t, s, "hooks@example.com")
+	other := CreateAddress(t, s, "other@example.com")
+
+	webhook := &store.Webhook{AddressID: address.ID, URL: "https://hooks.example.com/", Secret: "secret"}
+	if err := s.Webhooks.Create(ctx, webhook); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	webhooks, err := s.Webhooks.GetByAddress(ctx, address.ID)
+	if err != nil || len(webhooks) != 1 || webhooks[0].URL != webhook.URL || webhooks[0].Secret != "" {
+		t.Errorf("GetByAddress returned %+v, %v, want the webhook without its secret", webhooks, err)
+	}
+
+	message := CreateMessage(t, s, address, "hooked", BaseTime)
+	CreateMessage(t, s, other, "not hooked", BaseTime)
+
+	deliveries, err := s.Webhooks.ClaimDue(ctx, 10, time.Minute)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("ClaimDue returned %d deliveries, %v, want 1", len(deliveries), err)
+	}
+	delivery := deliveries[0]
+	if delivery.MessageID != int64(message.ID) || delivery.URL != webhook.URL || delivery.Secret != "secret" || !strings.Contains(string(delivery.Payload), "hooked") {
+		t.Errorf("delivery = %+v, want message %d posted to %s", delivery, message.ID, webhook.URL)
+	}
+
+	if leased, err := s.Webhooks.ClaimDue(ctx, 10, time.Minute); err != nil || len(leased) != 0 {
+		t.Errorf("ClaimDue returned %d leased deliveries, %v, want none", len(leased), err)
+	}
+
+	attempt := &store.WebhookAttempt{DeliveryID: delivery.ID, StatusCode: 500, Error: "unexpected status", Duration: 12}
+	if err := s.Webhooks.RecordAttempt(ctx, attempt, store.DeliveryPending, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("RecordAttempt failed: %v", err)
+	}
+	retried, err := s.Webhooks.ClaimDue(ctx, 10, time.Minute)
+	if err != nil || len(retried) != 1 || retried[0].Attempts != 1 {
+		t.Fatalf("ClaimDue after a failed attempt returned %+v, %v, want the delivery with 1 attempt", retried, err)
+	}
+
+	if err := s.Webhooks.RecordAttempt(ctx, &store.WebhookAttempt{DeliveryID: delivery.ID, StatusCode: 200}, store.DeliveryDelivered, time.Now()); err != nil {
+		t.Fatalf("RecordAttempt failed: %v", err)
+	}
+	if due, err := s.Webhooks.ClaimDue(ctx, 10, -time.Minute); err != nil || len(due) != 0 {
+		t.Errorf("ClaimDue returned %d delivered deliveries, %v, want none", len(due), err)
+	}
+
+	attempts, err := s.Webhooks.GetAttempts(ctx, webhook.ID, 10)
+	if err != nil || len(attempts) != 2 {
+		t.Fatalf("GetAttempts returned %d attempts, %v, want 2", len(attempts), err)
+	}
+	if attempts[0].StatusCode != 200 || attempts[1].StatusCode != 500 || attempts[1].Error != "unexpected status" || attempts[1].MessageID != int64(message.ID) {
+		t.Errorf("attempts = %+v, want the 200 followed by the failed 500", attempts)
+	}
+
+	if err := s.Webhooks.Delete(ctx, other.ID, webhook.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleting another address's webhook returned %v, want %v", err, store.ErrNotFound)
+	}
+	if err := s.Webhooks.Delete(ctx, address.ID, webhook.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if webhooks, _ := s.Webhooks.GetByAddress(ctx, address.ID); len(webhooks) != 0 {
+		t.Errorf("GetByAddress returned %d webhooks after Delete, want none", len(webhooks))
+	}
+}
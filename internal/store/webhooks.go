@@ -0,0 +1,40 @@
+package store
+
+import "time"
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	ID        int64     `json:"id"`
+	AddressID int64     `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only returned when the webhook is created
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is an outbox entry for a message that still has to be posted to a webhook
+type WebhookDelivery struct {
+	ID        int64
+	WebhookID int64
+	MessageID int64
+	URL       string
+	Secret    string
+	Payload   []byte
+	Attempts  int
+}
+
+// WebhookAttempt logs a single try at delivering a webhook
+type WebhookAttempt struct {
+	ID          int64     `json:"id"`
+	DeliveryID  int64     `json:"delivery_id"`
+	MessageID   int64     `json:"message_id"`
+	StatusCode  int       `json:"status_code"`
+	Error       string    `json:"error,omitempty"`
+	Duration    int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
@@ -0,0 +1,129 @@
+package sweeper
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+// DefaultBatchSize is the number of expired addresses or trashed messages deleted per transaction
+const DefaultBatchSize = 100
+
+// stats exposes the sweeper counters under "sweeper" on /debug/vars
+var stats = expvar.NewMap("sweeper")
+
+// Sweeper periodically purges messages that have been in the trash for longer than the grace
+// period and, when expireAddresses is set, expired addresses and their messages.
+type Sweeper struct {
+	store            *store.Storage
+	interval         time.Duration
+	trashGracePeriod time.Duration
+	expireAddresses  bool
+	batchSize        int
+}
+
+func New(storage *store.Storage, interval, trashGracePeriod time.Duration, expireAddresses bool) *Sweeper {
+	return &Sweeper{
+		store:            storage,
+		interval:         interval,
+		trashGracePeriod: trashGracePeriod,
+		expireAddresses:  expireAddresses,
+		batchSize:        DefaultBatchSize,
+	}
+}
+
+// Run sweeps once immediately and then on every interval until the context is cancelled.
+func (s *Sweeper) Run(ctx context.Context) {
+	log.Printf("Starting sweeper, running every %s", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sweep(ctx); err != nil {
+			log.Printf("Sweep failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep purges the trash and expired addresses in batches until none are left. It is safe to
+// run from several processes at once.
+func (s *Sweeper) Sweep(ctx context.Context) error {
+	stats.Add("runs", 1)
+
+	if err := s.purgeTrash(ctx); err != nil {
+		stats.Add("errors", 1)
+		return err
+	}
+
+	if !s.expireAddresses {
+		return nil
+	}
+	return s.deleteExpired(ctx)
+}
+
+// purgeTrash permanently deletes the messages that were trashed before the grace period
+func (s *Sweeper) purgeTrash(ctx context.Context) error {
+	var total int64
+	before := time.Now().Add(-s.trashGracePeriod)
+	for {
+		purged, err := s.store.Messages.PurgeDeleted(ctx, before, s.batchSize)
+		if err != nil {
+			return err
+		}
+
+		total += purged
+		stats.Add("trash_purged", purged)
+
+		if purged < int64(s.batchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Purged %d messages from the trash", total)
+	}
+	return nil
+}
+
+// deleteExpired deletes expired addresses, only one process deletes at any given time
+func (s *Sweeper) deleteExpired(ctx context.Context) error {
+	var totalAddresses, totalMessages int64
+	now := time.Now()
+	for {
+		addresses, messages, err := s.store.Addresses.DeleteExpired(ctx, now, s.batchSize)
+		if errors.Is(err, store.ErrLocked) {
+			log.Println("Another process is sweeping expired addresses, skipping this run")
+			stats.Add("skipped_runs", 1)
+			break
+		}
+		if err != nil {
+			stats.Add("errors", 1)
+			return err
+		}
+
+		totalAddresses += addresses
+		totalMessages += messages
+		stats.Add("addresses_deleted", addresses)
+		stats.Add("messages_deleted", messages)
+
+		if addresses < int64(s.batchSize) {
+			break
+		}
+	}
+
+	if totalAddresses > 0 {
+		log.Printf("Swept %d expired addresses and %d messages", totalAddresses, totalMessages)
+	}
+	return nil
+}
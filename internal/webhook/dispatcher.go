@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+const (
+	// MaxAttempts is the number of tries before a delivery is marked as failed
+	MaxAttempts = 8
+
+	// Headers sent with every delivery
+	EventHeader     = "X-TempMail-Event"
+	DeliveryHeader  = "X-TempMail-Delivery"
+	TimestampHeader = "X-TempMail-Timestamp"
+	SignatureHeader = "X-TempMail-Signature"
+
+	batchSize      = 20
+	requestTimeout = 10 * time.Second
+	// lease is how long a claimed delivery is hidden from other dispatchers
+	lease = time.Minute
+
+	initialBackoff = 30 * time.Second
+	maxBackoff     = 6 * time.Hour
+)
+
+// Dispatcher posts pending webhook deliveries from the outbox. Several dispatchers
+// can run against the same database, each delivery is only claimed by one of them.
+type Dispatcher struct {
+	store    *store.Storage
+	client   *http.Client
+	interval time.Duration
+}
+
+// NewDispatcher returns a dispatcher checking for due deliveries every interval. Deliveries
+// to private and loopback addresses are refused unless allowPrivate is set, which is meant
+// for local testing.
+func NewDispatcher(storage *store.Storage, interval time.Duration, allowPrivate bool) *Dispatcher {
+	return &Dispatcher{
+		store:    storage,
+		client:   newClient(allowPrivate),
+		interval: interval,
+	}
+}
+
+// Run dispatches due deliveries on every interval until the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	log.Printf("Starting webhook dispatcher, running every %s", d.interval)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Dispatch(ctx); err != nil {
+			log.Printf("Webhook dispatch failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch delivers every delivery that is currently due.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	for {
+		deliveries, err := d.store.Webhooks.ClaimDue(ctx, batchSize, lease)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			d.deliver(ctx, delivery)
+		}
+
+		if len(deliveries) < batchSize {
+			return nil
+		}
+	}
+}
+
+// deliver makes a single attempt at posting a delivery and schedules a retry if it fails
+func (d *Dispatcher) deliver(ctx context.Context, delivery store.WebhookDelivery) {
+	start := time.Now()
+	statusCode, err := d.post(ctx, delivery)
+
+	attempt := &store.WebhookAttempt{
+		DeliveryID: delivery.ID,
+		StatusCode: statusCode,
+		Duration:   time.Since(start).Milliseconds(),
+	}
+
+	status, nextAttemptAt := store.DeliveryDelivered, time.Now()
+	if err != nil {
+		attempt.Error = err.Error()
+
+		attempts := delivery.Attempts + 1
+		if attempts >= MaxAttempts {
+			status = store.DeliveryFailed
+			log.Printf("Giving up on webhook delivery %d to %s after %d attempts: %v", delivery.ID, delivery.URL, attempts, err)
+		} else {
+			status = store.DeliveryPending
+			nextAttemptAt = time.Now().Add(Backoff(attempts))
+			log.Printf("Webhook delivery %d to %s failed, retrying at %s: %v", delivery.ID, delivery.URL, nextAttemptAt.Format(time.RFC3339), err)
+		}
+	}
+
+	if err := d.store.Webhooks.RecordAttempt(ctx, attempt, status, nextAttemptAt); err != nil {
+		log.Printf("Failed to record attempt for webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// post sends the delivery payload, treating any non-2xx response as a failure
+func (d *Dispatcher) post(ctx context.Context, delivery store.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "temp-mail-webhooks/1.0")
+	req.Header.Set(EventHeader, "message.created")
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value for a payload: the hex encoded HMAC-SHA256 of
+// "<timestamp>.<payload>" keyed with the webhook secret, prefixed with "sha256=".
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff is the delay before retrying a delivery that failed the given number of times
+func Backoff(attempts int) time.Duration {
+	backoff := initialBackoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+// recordedAttempt is an attempt as the dispatcher recorded it
+type recordedAttempt struct {
+	attempt       store.WebhookAttempt
+	status        string
+	nextAttemptAt time.Time
+}
+
+// recordingWebhooks keeps the status and retry time the dispatcher records, which the
+// store doesn't expose
+type recordingWebhooks struct {
+	*store.MemoryWebhookStore
+
+	mu       sync.Mutex
+	recorded []recordedAttempt
+}
+
+func (s *recordingWebhooks) RecordAttempt(ctx context.Context, attempt *store.WebhookAttempt, status string, nextAttemptAt time.Time) error {
+	if err := s.MemoryWebhookStore.RecordAttempt(ctx, attempt, status, nextAttemptAt); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recorded = append(s.recorded, recordedAttempt{*attempt, status, nextAttemptAt})
+	return nil
+}
+
+func (s *recordingWebhooks) last(t *testing.T) recordedAttempt {
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.recorded) == 0 {
+		t.Fatal("no attempt was recorded")
+	}
+	return s.recorded[len(s.recorded)-1]
+}
+
+// newTestDispatcher returns a dispatcher for a webhook posting to url with a queued
+// delivery for one message
+func newTestDispatcher(t *testing.T, url string) (*Dispatcher, *recordingWebhooks, *store.Webhook) {
+	t.Helper()
+	ctx := context.Background()
+
+	storage := store.NewMemoryStorage()
+	webhooks := &recordingWebhooks{MemoryWebhookStore: storage.Webhooks.(*store.MemoryWebhookStore)}
+	storage.Webhooks = webhooks
+
+	address := &store.Address{Email: "alice@example.com", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := storage.Addresses.Create(ctx, address); err != nil {
+		t.Fatalf("failed to create address: %v", err)
+	}
+	webhook := &store.Webhook{AddressID: address.ID, URL: url, Secret: "whsec_test"}
+	if err := storage.Webhooks.Create(ctx, webhook); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	message := &store.Message{
+		FromAddress: "sender@example.com",
+		ToAddressID: uint(address.ID),
+		Subject:     "Hello",
+		Headers:     []byte(`{}`),
+		ReceivedAt:  time.Now(),
+	}
+	if err := storage.Messages.Create(ctx, message); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+
+	return NewDispatcher(storage, time.Minute, true), webhooks, webhook
+}
+
+func TestDispatchSignsDeliveries(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{r.Header.Clone(), body}
+	}))
+	defer server.Close()
+
+	dispatcher, webhooks, webhook := newTestDispatcher(t, server.URL)
+	if err := dispatcher.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+
+	var req received
+	select {
+	case req = <-requests:
+	default:
+		t.Fatal("the webhook wasn't called")
+	}
+
+	if got := req.header.Get(EventHeader); got != "message.created" {
+		t.Errorf("%s = %q, want %q", EventHeader, got, "message.created")
+	}
+	timestamp, err := strconv.ParseInt(req.header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid %s %q: %v", TimestampHeader, req.header.Get(TimestampHeader), err)
+	}
+
+	// Verify the signature the way receivers are told to, without going through Sign
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(req.body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.header.Get(SignatureHeader) != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, req.header.Get(SignatureHeader), want)
+	}
+
+	recorded := webhooks.last(t)
+	if recorded.status != store.DeliveryDelivered || recorded.attempt.StatusCode != http.StatusOK || recorded.attempt.Error != "" {
+		t.Errorf("recorded %+v, want a delivered attempt with status 200", recorded)
+	}
+	if got := req.header.Get(DeliveryHeader); got != strconv.FormatInt(recorded.attempt.DeliveryID, 10) {
+		t.Errorf("%s = %q, want %d", DeliveryHeader, got, recorded.attempt.DeliveryID)
+	}
+
+	attempts, err := webhooks.GetAttempts(context.Background(), webhook.ID, 10)
+	if err != nil {
+		t.Fatalf("GetAttempts failed: %v", err)
+	}
+	if len(attempts) != 1 || attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("GetAttempts = %+v, want one attempt with status 200", attempts)
+	}
+}
+
+func TestDispatchRetriesFailedDeliveries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	dispatcher, webhooks, webhook := newTestDispatcher(t, server.URL)
+	before := time.Now()
+	if err := dispatcher.Dispatch(ctx); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+
+	recorded := webhooks.last(t)
+	if recorded.status != store.DeliveryPending {
+		t.Errorf("status = %q, want %q", recorded.status, store.DeliveryPending)
+	}
+	if recorded.attempt.StatusCode != http.StatusInternalServerError || recorded.attempt.Error == "" {
+		t.Errorf("attempt = %+v, want a failed attempt with status 500", recorded.attempt)
+	}
+	if earliest, latest := before.Add(Backoff(1)), time.Now().Add(Backoff(1)); recorded.nextAttemptAt.Before(earliest) || recorded.nextAttemptAt.After(latest) {
+		t.Errorf("next attempt at %s, want %s after the attempt", recorded.nextAttemptAt, Backoff(1))
+	}
+
+	// The retry isn't due yet, so the next run doesn't post again
+	if due, err := webhooks.ClaimDue(ctx, batchSize, lease); err != nil || len(due) != 0 {
+		t.Errorf("ClaimDue = %v, %v, want nothing due before the backoff", due, err)
+	}
+
+	attempts, err := webhooks.GetAttempts(ctx, webhook.ID, 10)
+	if err != nil {
+		t.Fatalf("GetAttempts failed: %v", err)
+	}
+	if len(attempts) != 1 || attempts[0].StatusCode != http.StatusInternalServerError || attempts[0].Error != recorded.attempt.Error {
+		t.Errorf("GetAttempts = %+v, want the failed attempt", attempts)
+	}
+}
+
+func TestDispatchGivesUpAfterMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	dispatcher, webhooks, _ := newTestDispatcher(t, server.URL)
+	deliveries, err := webhooks.ClaimDue(ctx, batchSize, lease)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("ClaimDue = %v, %v, want one delivery", deliveries, err)
+	}
+
+	delivery := deliveries[0]
+	for attempts := 1; attempts <= MaxAttempts; attempts++ {
+		dispatcher.deliver(ctx, delivery)
+		delivery.Attempts++
+
+		want := store.DeliveryPending
+		if attempts == MaxAttempts {
+			want = store.DeliveryFailed
+		}
+		if recorded := webhooks.last(t); recorded.status != want {
+			t.Fatalf("status after %d attempts = %q, want %q", attempts, recorded.status, want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{10, 4*time.Hour + 16*time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
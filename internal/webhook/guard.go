@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for webhook URLs resolving to an address that isn't
+// publicly routable, so that webhooks can't be used to reach the deployment's own network
+var ErrForbiddenAddress = errors.New("webhook URL resolves to a non-public address")
+
+// sharedAddressSpace is the carrier-grade NAT range, which netip doesn't treat as private
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPublicAddr reports whether webhooks may be delivered to ip
+func IsPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsUnspecified() &&
+		!ip.IsMulticast() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// CheckHost resolves host and fails with ErrForbiddenAddress if any of its addresses isn't
+// public. Deliveries are checked again when dialing, as DNS can change in the meantime.
+func CheckHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !IsPublicAddr(addr) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// rejectNonPublic is a net.Dialer control function, it runs after DNS resolution with the
+// address actually being dialed
+func rejectNonPublic(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	if !IsPublicAddr(addrPort.Addr()) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// newClient returns the HTTP client deliveries are posted with. Unless allowPrivate is set
+// it only connects to public addresses. It ignores proxy settings since a proxy would be
+// dialed instead of the target and doesn't follow redirects, which could point anywhere.
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !allowPrivate {
+		dialer.Control = rejectNonPublic
+	}
+
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          20,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
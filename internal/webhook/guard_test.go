@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:93.184.215.14", true},
+	}
+
+	for _, tt := range tests {
+		if got := IsPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("IsPublicAddr(%s) = %t, want %t", tt.addr, got, tt.public)
+		}
+	}
+}
+
+func TestClientRefusesLocalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := newClient(false).Post(server.URL, "application/json", nil)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("posting to %s returned %v, want %v", server.URL, err, ErrForbiddenAddress)
+	}
+
+	resp, err := newClient(true).Post(server.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("posting to %s with private addresses allowed failed: %v", server.URL, err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Address is a temporary email address. Token is only set on addresses returned by
+// CreateAddress.
+type Address struct {
+	Email        string    `json:"email"`
+	Token        string    `json:"token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	MessageCount int64     `json:"message_count"`
+	UnreadCount  int64     `json:"unread_count"`
+}
+
+// CreateAddressRequest chooses the address to create. Every field is optional, the zero
+// value creates a random address on a random domain with the default lifetime.
+type CreateAddressRequest struct {
+	LocalPart string `json:"local_part,omitempty"`
+	Domain    string `json:"domain,omitempty"`
+	TTL       string `json:"ttl,omitempty"` // Go duration, e.g. "90m"
+}
+
+// CreateAddress creates an address. The returned address carries the token needed to read
+// its messages, which is only ever returned here. Taken addresses fail with ErrConflict.
+func (c *Client) CreateAddress(ctx context.Context, req CreateAddressRequest) (*Address, error) {
+	var address Address
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/addresses", body: req}, &address); err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// Mailbox returns a handle on the address email, authenticated with its token
+func (c *Client) Mailbox(email, token string) *Mailbox {
+	return &Mailbox{Email: email, client: c, token: token}
+}
+
+// Mailbox reads and manages the messages of a single address
+type Mailbox struct {
+	Email string
+
+	client *Client
+	token  string
+}
+
+func (m *Mailbox) addressPath(suffix string) string {
+	return "/addresses/" + url.PathEscape(m.Email) + suffix
+}
+
+// Get gets the address with its expiry and message counts
+func (m *Mailbox) Get(ctx context.Context) (*Address, error) {
+	var address Address
+	if err := m.client.do(ctx, request{method: http.MethodGet, path: m.addressPath(""), token: m.token}, &address); err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// Extend pushes back the expiry of the address by ttl, or by the server's default lifetime
+// when ttl is zero
+func (m *Mailbox) Extend(ctx context.Context, ttl time.Duration) (*Address, error) {
+	body := map[string]string{}
+	if ttl > 0 {
+		body["ttl"] = ttl.String()
+	}
+
+	var address Address
+	req := request{method: http.MethodPost, path: m.addressPath("/extend"), token: m.token, body: body}
+	if err := m.client.do(ctx, req, &address); err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// Delete permanently deletes the address and all of its messages
+func (m *Mailbox) Delete(ctx context.Context) error {
+	return m.client.do(ctx, request{method: http.MethodDelete, path: m.addressPath(""), token: m.token}, nil)
+}
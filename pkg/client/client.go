@@ -0,0 +1,240 @@
+// Package client is a Go client for the temp-mail HTTP API.
+//
+//	c := client.New("https://mail.example.com")
+//	address, err := c.CreateAddress(ctx, client.CreateAddressRequest{})
+//	mailbox := c.Mailbox(address.Email, address.Token)
+//	message, err := mailbox.Wait(ctx, client.WaitOptions{Subject: "Verify"})
+//
+// Responses are unwrapped from the API's {"data": ...} envelope and failed requests are
+// returned as *APIError. Idempotent requests failing with a 5xx status or a network error are
+// retried, requests creating something are sent once.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetries      = 3
+	defaultRetryBackoff = 200 * time.Millisecond
+)
+
+// Client talks to a temp-mail API. It is safe for concurrent use.
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	retries      int
+	retryBackoff time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. Its timeout has to leave room for
+// Mailbox.Wait, which holds requests open for up to two minutes.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithRetries sets how many times an idempotent request (GET, HEAD, PUT or DELETE) failing
+// with a 5xx status or a network error is retried, 3 by default. Waits between retries start
+// at backoff and double every time. POST requests are never retried, as a request that failed
+// on the way back may still have created an address.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryBackoff = backoff
+	}
+}
+
+// New returns a client for the API at baseURL, e.g. https://mail.example.com
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/") + "/v1",
+		httpClient:   http.DefaultClient,
+		retries:      defaultRetries,
+		retryBackoff: defaultRetryBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Errors matched by APIError, e.g. errors.Is(err, client.ErrNotFound)
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+)
+
+// APIError is returned when the API answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string // the error reported by the API
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("temp-mail API: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Is makes APIError match the error for its status code
+func (e *APIError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return target == ErrBadRequest
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	}
+	return false
+}
+
+// request describes an API call. body is encoded as JSON when set.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	token  string
+	body   any
+}
+
+// send performs a request, retrying idempotent ones on 5xx statuses and network errors.
+// Responses with any other error status are returned as *APIError, so the caller only sees
+// 2xx responses and must close their body. The one exception is a 404 answering a retried
+// DELETE, which means an earlier attempt went through even though its response was lost.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	target := c.baseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Accept", "application/json")
+		if body != nil {
+			httpReq.Header.Set("Content-Type", "application/json")
+		}
+		if req.token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+req.token)
+		}
+
+		resp, err := c.httpClient.Do(httpReq)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			if attempt > 0 && req.method == http.MethodDelete && resp.StatusCode == http.StatusNotFound {
+				return resp, nil
+			}
+			if resp.StatusCode >= http.StatusBadRequest {
+				defer resp.Body.Close()
+				return nil, readAPIError(resp)
+			}
+			return resp, nil
+		}
+
+		if err == nil {
+			err = readAPIError(resp)
+			resp.Body.Close()
+		}
+		if attempt >= c.retries || !idempotent(req.method) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// idempotent reports whether sending a request with method twice has the same effect as
+// sending it once, which makes it safe to retry
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// readAPIError turns an error response into an *APIError
+func readAPIError(resp *http.Response) error {
+	var envelope struct {
+		Data struct {
+			Error string `json:"error"`
+		} `json:"data"`
+	}
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err == nil {
+		apiErr.Message = envelope.Data.Error
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
+
+// do performs a request and decodes the data of the response envelope into out, unless out
+// is nil
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	return decodeData(resp, out)
+}
+
+func decodeData(resp *http.Response, out any) error {
+	envelope := struct {
+		Data any `json:"data"`
+	}{Data: out}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// download performs a request and returns the response body as is
+func (c *Client) download(ctx context.Context, req request) ([]byte, error) {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
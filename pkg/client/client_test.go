@@ -0,0 +1,277 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for handler that retries twice without waiting long
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(server.URL, WithRetries(2, time.Millisecond))
+}
+
+// writeData writes v in the API's response envelope
+func writeData(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"data": v})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeData(w, status, map[string]string{"error": message})
+}
+
+func TestCreateAddress(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req CreateAddressRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/addresses" || req.LocalPart != "alice" {
+			t.Errorf("got %s %s with %+v", r.Method, r.URL.Path, req)
+		}
+		writeData(w, http.StatusCreated, map[string]any{
+			"email":      "alice@example.com",
+			"token":      "secret",
+			"expires_at": "2026-10-18T13:00:00Z",
+			"created_at": "2026-10-18T12:00:00Z",
+		})
+	})
+
+	address, err := c.CreateAddress(context.Background(), CreateAddressRequest{LocalPart: "alice"})
+	if err != nil {
+		t.Fatalf("CreateAddress failed: %v", err)
+	}
+	if address.Email != "alice@example.com" || address.Token != "secret" || !address.ExpiresAt.Equal(time.Date(2026, 10, 18, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("CreateAddress returned %+v", address)
+	}
+}
+
+func TestMailboxSendsToken(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			writeError(w, http.StatusUnauthorized, "missing token")
+			return
+		}
+		if r.URL.EscapedPath() != "/v1/addresses/alice@example.com" {
+			t.Errorf("got path %s", r.URL.EscapedPath())
+		}
+		writeData(w, http.StatusOK, map[string]any{"email": "alice@example.com", "message_count": 2, "unread_count": 1})
+	})
+
+	address, err := c.Mailbox("alice@example.com", "secret").Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if address.MessageCount != 2 || address.UnreadCount != 1 {
+		t.Errorf("Get returned %+v", address)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		status  int
+		body    string
+		target  error
+		message string
+	}{
+		{http.StatusBadRequest, `{"data":{"error":"ttl must be positive"}}`, ErrBadRequest, "ttl must be positive"},
+		{http.StatusUnauthorized, `{"data":{"error":"invalid token"}}`, ErrUnauthorized, "invalid token"},
+		{http.StatusForbidden, `{"data":{"error":"forbidden"}}`, ErrForbidden, "forbidden"},
+		{http.StatusNotFound, `{"data":{"error":"the requested resource could not be found"}}`, ErrNotFound, "the requested resource could not be found"},
+		{http.StatusConflict, `{"data":{"error":"address is taken"}}`, ErrConflict, "address is taken"},
+		{http.StatusGone, "not json", nil, "Gone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			_, err := c.Mailbox("alice@example.com", "secret").Get(context.Background())
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Get returned %v, want an *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.message {
+				t.Errorf("Get returned %d %q, want %d %q", apiErr.StatusCode, apiErr.Message, tt.status, tt.message)
+			}
+
+			for _, sentinel := range []error{ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict} {
+				if got, want := errors.Is(err, sentinel), sentinel == tt.target; got != want {
+					t.Errorf("errors.Is(%v, %v) = %t, want %t", err, sentinel, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		call     func(*Mailbox) error
+		attempts int32
+	}{
+		{"GET", http.MethodGet, func(m *Mailbox) error { _, err := m.Get(context.Background()); return err }, 3},
+		{"PUT", http.MethodPut, func(m *Mailbox) error { return m.MarkRead(context.Background(), 1) }, 3},
+		{"DELETE", http.MethodDelete, func(m *Mailbox) error { return m.DeleteMessage(context.Background(), 1) }, 3},
+		{"POST", http.MethodPost, func(m *Mailbox) error { return m.RestoreMessage(context.Background(), 1) }, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Run("recovers", func(t *testing.T) {
+				var attempts atomic.Int32
+				c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+					if r.Method != tt.method {
+						t.Errorf("got method %s, want %s", r.Method, tt.method)
+					}
+					if attempts.Add(1) < 3 {
+						writeError(w, http.StatusServiceUnavailable, "try again")
+						return
+					}
+					writeData(w, http.StatusOK, map[string]any{})
+				})
+
+				err := tt.call(c.Mailbox("alice@example.com", "secret"))
+				if tt.attempts == 3 && err != nil {
+					t.Errorf("call failed after retrying: %v", err)
+				}
+				if got := attempts.Load(); got != tt.attempts {
+					t.Errorf("the request was sent %d times, want %d", got, tt.attempts)
+				}
+			})
+
+			t.Run("gives up", func(t *testing.T) {
+				var attempts atomic.Int32
+				c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+					attempts.Add(1)
+					writeError(w, http.StatusInternalServerError, "broken")
+				})
+
+				err := tt.call(c.Mailbox("alice@example.com", "secret"))
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || apiErr.Message != "broken" {
+					t.Errorf("call returned %v, want the 500 error", err)
+				}
+				if got := attempts.Load(); got != tt.attempts {
+					t.Errorf("the request was sent %d times, want %d", got, tt.attempts)
+				}
+			})
+		})
+	}
+}
+
+func TestRetriedDeleteNotFound(t *testing.T) {
+	var attempts atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt deletes the message but its response is lost
+		if attempts.Add(1) == 1 {
+			writeError(w, http.StatusBadGateway, "bad gateway")
+			return
+		}
+		writeError(w, http.StatusNotFound, "the requested resource could not be found")
+	})
+
+	if err := c.Mailbox("alice@example.com", "secret").DeleteMessage(context.Background(), 1); err != nil {
+		t.Errorf("DeleteMessage returned %v after the retry found nothing to delete, want nil", err)
+	}
+
+	c = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "the requested resource could not be found")
+	})
+	if err := c.Mailbox("alice@example.com", "secret").DeleteMessage(context.Background(), 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteMessage of a missing message returned %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestWait(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/v1/messages/wait" || query.Get("timeout") != "1s" || query.Get("subject") != "Verify" {
+			t.Errorf("got %s?%s", r.URL.Path, r.URL.RawQuery)
+		}
+		if query.Get("from") == "nobody" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeData(w, http.StatusOK, map[string]any{"id": 7, "subject": "Verify your email", "codes": []string{"123456"}})
+	})
+	mailbox := c.Mailbox("alice@example.com", "secret")
+
+	message, err := mailbox.Wait(context.Background(), WaitOptions{Timeout: time.Second, Subject: "Verify"})
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if message.ID != 7 || !slices.Equal(message.Codes, []string{"123456"}) {
+		t.Errorf("Wait returned %+v", message)
+	}
+
+	if _, err := mailbox.Wait(context.Background(), WaitOptions{Timeout: time.Second, Subject: "Verify", From: "nobody"}); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("Wait returned %v, want %v", err, ErrNoMessage)
+	}
+}
+
+func TestListFollowsCursor(t *testing.T) {
+	pages := map[string]struct {
+		ids  []uint
+		next string
+	}{
+		"":   {[]uint{5, 4}, "c1"},
+		"c1": {[]uint{3, 2}, "c2"},
+		"c2": {[]uint{1}, ""},
+	}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("limit"); got != "2" {
+			t.Errorf("got limit %q, want 2", got)
+		}
+		page := pages[r.URL.Query().Get("cursor")]
+		summaries := []MessageSummary{}
+		for _, id := range page.ids {
+			summaries = append(summaries, MessageSummary{ID: id})
+		}
+		if page.next != "" {
+			w.Header().Set("X-Next-Cursor", page.next)
+		}
+		writeData(w, http.StatusOK, summaries)
+	})
+	mailbox := c.Mailbox("alice@example.com", "secret")
+
+	ids := []uint{}
+	options := ListOptions{Limit: 2}
+	for requests := 0; ; requests++ {
+		if requests > len(pages) {
+			t.Fatal("List kept returning a next cursor")
+		}
+
+		page, err := mailbox.List(context.Background(), options)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for _, message := range page.Messages {
+			ids = append(ids, message.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		options.Cursor = page.NextCursor
+	}
+
+	if want := []uint{5, 4, 3, 2, 1}; !slices.Equal(ids, want) {
+		t.Errorf("paging through List returned %v, want %v", ids, want)
+	}
+}
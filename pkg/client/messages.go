@@ -0,0 +1,283 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ErrNoMessage is returned by Mailbox.Wait when no message arrived before the timeout
+var ErrNoMessage = errors.New("no message arrived before the timeout")
+
+// Message is a received message with its bodies, MIME structure and attachment metadata
+type Message struct {
+	ID          uint          `json:"id"`
+	FromAddress string        `json:"from_address"`
+	Headers     []byte        `json:"headers"` // JSON object of the header names and their values
+	Subject     string        `json:"subject"`
+	Snippet     string        `json:"snippet"`
+	BodyHTML    *string       `json:"body_html"`
+	BodyPlain   *string       `json:"body_plain"`
+	ContentType string        `json:"content_type"`
+	MIMETree    *MessagePart  `json:"mime_tree"`
+	Attachments []Attachment  `json:"attachments,omitempty"`
+	Codes       []string      `json:"codes"` // one-time codes found in the message
+	Links       []MessageLink `json:"links"` // verification, password reset and magic links
+	ReceivedAt  time.Time     `json:"received_at"`
+	ReadAt      *time.Time    `json:"read_at"` // nil while the message is unread
+}
+
+// MessageSummary is the lightweight form of a message returned when listing a mailbox
+type MessageSummary struct {
+	ID             uint          `json:"id"`
+	FromAddress    string        `json:"from_address"`
+	Subject        string        `json:"subject"`
+	Snippet        string        `json:"snippet"`
+	Codes          []string      `json:"codes"`
+	Links          []MessageLink `json:"links"`
+	ReceivedAt     time.Time     `json:"received_at"`
+	ReadAt         *time.Time    `json:"read_at"` // nil while the message is unread
+	HasAttachments bool          `json:"has_attachments"`
+}
+
+// MessageSearchResult is a message matching a search query with the matching parts highlighted
+type MessageSearchResult struct {
+	MessageSummary
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
+
+// MessagePart describes a single node of a message's MIME tree
+type MessagePart struct {
+	ContentType string        `json:"content_type"`
+	Charset     string        `json:"charset,omitempty"`
+	Encoding    string        `json:"encoding,omitempty"`
+	Disposition string        `json:"disposition,omitempty"`
+	Filename    string        `json:"filename,omitempty"`
+	ContentID   string        `json:"content_id,omitempty"`
+	Size        int           `json:"size"`
+	Parts       []MessagePart `json:"parts,omitempty"`
+}
+
+// Kinds of MessageLink
+const (
+	LinkVerification  = "verification"
+	LinkPasswordReset = "password_reset"
+	LinkMagicLink     = "magic_link"
+)
+
+// MessageLink is an actionable link found in a message body
+type MessageLink struct {
+	URL  string `json:"url"`
+	Kind string `json:"kind"` // LinkVerification, LinkPasswordReset or LinkMagicLink
+	Text string `json:"text,omitempty"`
+}
+
+// Attachment describes a file attached to a message, its content is fetched with
+// Mailbox.DownloadAttachment
+type Attachment struct {
+	ID          int64  `json:"id"`
+	MessageID   int64  `json:"message_id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	ContentID   string `json:"content_id,omitempty"`
+	Checksum    string `json:"checksum"` // hex encoded SHA-256 of the content
+}
+
+// ListOptions filters and paginates Mailbox.List. The zero value lists the first page of
+// every message.
+type ListOptions struct {
+	Limit          int    // page size, the server's default when zero
+	Cursor         string // Page.NextCursor of the previous page
+	Unread         bool
+	HasAttachments *bool
+	After          time.Time
+	Before         time.Time
+	From           string // part of the sender's address
+	Subject        string // part of the subject
+}
+
+func (o ListOptions) query() url.Values {
+	query := url.Values{}
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		query.Set("cursor", o.Cursor)
+	}
+	if o.Unread {
+		query.Set("unread", "true")
+	}
+	if o.HasAttachments != nil {
+		query.Set("has_attachments", strconv.FormatBool(*o.HasAttachments))
+	}
+	if !o.After.IsZero() {
+		query.Set("after", o.After.Format(time.RFC3339Nano))
+	}
+	if !o.Before.IsZero() {
+		query.Set("before", o.Before.Format(time.RFC3339Nano))
+	}
+	if o.From != "" {
+		query.Set("from", o.From)
+	}
+	if o.Subject != "" {
+		query.Set("subject", o.Subject)
+	}
+	return query
+}
+
+// Page is a page of messages, newest first
+type Page struct {
+	Messages []MessageSummary
+	// NextCursor gets the next page when passed in ListOptions.Cursor, it is empty on the
+	// last page
+	NextCursor string
+}
+
+// List gets a page of the messages of the address, newest first
+func (m *Mailbox) List(ctx context.Context, options ListOptions) (*Page, error) {
+	query := options.query()
+	query.Set("email", m.Email)
+
+	resp, err := m.client.send(ctx, request{method: http.MethodGet, path: "/messages", query: query, token: m.token})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page := &Page{NextCursor: resp.Header.Get("X-Next-Cursor")}
+	if err := decodeData(resp, &page.Messages); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Search gets the messages of the address matching a web search style query such as
+// `"password reset" staging -prod`, best matches first. The server's default limit is used
+// when limit is zero.
+func (m *Mailbox) Search(ctx context.Context, q string, limit int) ([]MessageSearchResult, error) {
+	query := url.Values{"email": {m.Email}, "q": {q}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var results []MessageSearchResult
+	if err := m.client.do(ctx, request{method: http.MethodGet, path: "/messages/search", query: query, token: m.token}, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Message gets a message with its body and the metadata of its attachments
+func (m *Mailbox) Message(ctx context.Context, id uint) (*Message, error) {
+	var message Message
+	if err := m.client.do(ctx, request{method: http.MethodGet, path: messagePath(id, ""), token: m.token}, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// WaitOptions selects the message Mailbox.Wait waits for
+type WaitOptions struct {
+	// Timeout is how long the server waits, 30s when zero and at most two minutes
+	Timeout time.Duration
+	// Since also matches messages received after this time but before the call, by default
+	// only messages received during the call match
+	Since   time.Time
+	From    string // part of the sender's address
+	Subject string // part of the subject
+}
+
+// Wait returns the first message matching the options, waiting for it to arrive. It fails
+// with ErrNoMessage when none arrives before the timeout.
+func (m *Mailbox) Wait(ctx context.Context, options WaitOptions) (*Message, error) {
+	query := url.Values{"email": {m.Email}}
+	if options.Timeout > 0 {
+		query.Set("timeout", options.Timeout.String())
+	}
+	if !options.Since.IsZero() {
+		query.Set("since", options.Since.Format(time.RFC3339Nano))
+	}
+	if options.From != "" {
+		query.Set("from", options.From)
+	}
+	if options.Subject != "" {
+		query.Set("subject", options.Subject)
+	}
+
+	resp, err := m.client.send(ctx, request{method: http.MethodGet, path: "/messages/wait", query: query, token: m.token})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, ErrNoMessage
+	}
+
+	var message Message
+	if err := decodeData(resp, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// DeleteMessage moves a message to the trash, from where RestoreMessage takes it back until
+// the server purges it
+func (m *Mailbox) DeleteMessage(ctx context.Context, id uint) error {
+	return m.client.do(ctx, request{method: http.MethodDelete, path: messagePath(id, ""), token: m.token}, nil)
+}
+
+// RestoreMessage takes a message back out of the trash
+func (m *Mailbox) RestoreMessage(ctx context.Context, id uint) error {
+	return m.client.do(ctx, request{method: http.MethodPost, path: messagePath(id, "/restore"), token: m.token}, nil)
+}
+
+// MarkRead marks a message read
+func (m *Mailbox) MarkRead(ctx context.Context, id uint) error {
+	return m.client.do(ctx, request{method: http.MethodPut, path: messagePath(id, "/read"), token: m.token}, nil)
+}
+
+// MarkUnread marks a message unread
+func (m *Mailbox) MarkUnread(ctx context.Context, id uint) error {
+	return m.client.do(ctx, request{method: http.MethodDelete, path: messagePath(id, "/read"), token: m.token}, nil)
+}
+
+// MarkAllRead marks every message of the address read, returning how many were unread
+func (m *Mailbox) MarkAllRead(ctx context.Context) (int64, error) {
+	var result struct {
+		Updated int64 `json:"updated"`
+	}
+	if err := m.client.do(ctx, request{method: http.MethodPost, path: m.addressPath("/read-all"), token: m.token}, &result); err != nil {
+		return 0, err
+	}
+	return result.Updated, nil
+}
+
+// Raw downloads the original source of a message
+func (m *Mailbox) Raw(ctx context.Context, id uint) ([]byte, error) {
+	return m.client.download(ctx, request{method: http.MethodGet, path: messagePath(id, "/raw"), token: m.token})
+}
+
+// Attachments gets the metadata of the attachments of a message
+func (m *Mailbox) Attachments(ctx context.Context, id uint) ([]Attachment, error) {
+	var attachments []Attachment
+	if err := m.client.do(ctx, request{method: http.MethodGet, path: messagePath(id, "/attachments"), token: m.token}, &attachments); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// DownloadAttachment downloads the content of an attachment of a message
+func (m *Mailbox) DownloadAttachment(ctx context.Context, messageID uint, attachmentID int64) ([]byte, error) {
+	path := messagePath(messageID, "/attachments/"+strconv.FormatInt(attachmentID, 10))
+	return m.client.download(ctx, request{method: http.MethodGet, path: path, token: m.token})
+}
+
+func messagePath(id uint, suffix string) string {
+	return "/messages/" + strconv.FormatUint(uint64(id), 10) + suffix
+}
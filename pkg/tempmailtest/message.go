@@ -0,0 +1,159 @@
+package tempmailtest
+
+import (
+	"encoding/json"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+// Kinds of links extracted from messages
+const (
+	LinkVerification  = "verification"
+	LinkPasswordReset = "password_reset"
+	LinkMagicLink     = "magic_link"
+)
+
+// Message is a received message with the codes and links extracted from it
+type Message struct {
+	ID          uint
+	From        string
+	Subject     string
+	Header      mail.Header
+	Codes       []string // one-time codes, most likely first
+	Links       []Link
+	Attachments []Attachment
+	ReceivedAt  time.Time
+
+	text string
+	html string
+}
+
+// Link is a verification, password reset or magic link found in a message
+type Link struct {
+	URL  string
+	Kind string // LinkVerification, LinkPasswordReset or LinkMagicLink
+	Text string // the link text in the html body
+}
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// newMessage copies a stored message, the attachments are passed separately as messages are
+// loaded without them
+func newMessage(stored *store.Message, attachments []Attachment) Message {
+	message := Message{
+		ID:          stored.ID,
+		From:        stored.FromAddress,
+		Subject:     stored.Subject,
+		Codes:       stored.Codes,
+		Links:       make([]Link, len(stored.Links)),
+		Attachments: attachments,
+		ReceivedAt:  stored.ReceivedAt,
+	}
+	for i, link := range stored.Links {
+		message.Links[i] = Link{URL: link.URL, Kind: link.Kind, Text: link.Text}
+	}
+	if stored.BodyPlain != nil {
+		message.text = *stored.BodyPlain
+	}
+	if stored.BodyHTML != nil {
+		message.html = *stored.BodyHTML
+	}
+	// Headers are stored as the JSON of a mail.Header
+	json.Unmarshal(stored.Headers, &message.Header)
+	return message
+}
+
+// OTP returns the most likely one-time code of the message, or "" when it has none
+func (m *Message) OTP() string {
+	if len(m.Codes) == 0 {
+		return ""
+	}
+	return m.Codes[0]
+}
+
+// Link returns the URL of the first link of the given kind, or "" when there is none
+func (m *Message) Link(kind string) string {
+	for _, link := range m.Links {
+		if link.Kind == kind {
+			return link.URL
+		}
+	}
+	return ""
+}
+
+// VerificationLink returns the URL of the first verification link, or "" when there is none
+func (m *Message) VerificationLink() string {
+	return m.Link(LinkVerification)
+}
+
+// PasswordResetLink returns the URL of the first password reset link, or "" when there is none
+func (m *Message) PasswordResetLink() string {
+	return m.Link(LinkPasswordReset)
+}
+
+// MagicLink returns the URL of the first magic sign-in link, or "" when there is none
+func (m *Message) MagicLink() string {
+	return m.Link(LinkMagicLink)
+}
+
+// Text returns the plain text body of the message, or "" when it only has an html body
+func (m *Message) Text() string {
+	return m.text
+}
+
+// HTML returns the html body of the message, or "" when it only has a plain text body
+func (m *Message) HTML() string {
+	return m.html
+}
+
+// Matcher selects messages for Inbox.WaitFor
+type Matcher func(*Message) bool
+
+// Any matches every message
+func Any() Matcher {
+	return func(*Message) bool { return true }
+}
+
+// From matches messages whose sender contains s, ignoring case
+func From(s string) Matcher {
+	return func(m *Message) bool {
+		return strings.Contains(strings.ToLower(m.From), strings.ToLower(s))
+	}
+}
+
+// Subject matches messages whose subject contains s, ignoring case
+func Subject(s string) Matcher {
+	return func(m *Message) bool {
+		return strings.Contains(strings.ToLower(m.Subject), strings.ToLower(s))
+	}
+}
+
+// HasOTP matches messages with a one-time code
+func HasOTP() Matcher {
+	return func(m *Message) bool { return m.OTP() != "" }
+}
+
+// HasLink matches messages with a link of the given kind
+func HasLink(kind string) Matcher {
+	return func(m *Message) bool { return m.Link(kind) != "" }
+}
+
+// All matches messages matching every one of matchers
+func All(matchers ...Matcher) Matcher {
+	return func(m *Message) bool {
+		for _, matcher := range matchers {
+			if !matcher(m) {
+				return false
+			}
+		}
+		return true
+	}
+}
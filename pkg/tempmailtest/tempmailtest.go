@@ -0,0 +1,218 @@
+// Package tempmailtest runs the temp-mail SMTP server in-process for integration tests. Point
+// the code under test at Server.Addr, send mail to an Inbox and assert on what arrives:
+//
+//	inbox := tempmailtest.NewInbox(t)
+//	signUp(inbox.SMTPAddr(), inbox.Address)
+//	message, err := inbox.WaitFor(ctx, tempmailtest.Subject("Verify"))
+//	code := message.OTP()
+//
+// Messages are kept in memory and go through the same parsing as in production, so codes and
+// links are extracted the same way.
+package tempmailtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-smtp"
+
+	"github.com/AmoabaKelvin/temp-mail/internal/events"
+	"github.com/AmoabaKelvin/temp-mail/internal/mailserver"
+	"github.com/AmoabaKelvin/temp-mail/internal/store"
+)
+
+// DefaultDomain is the domain of inbox addresses unless Server.Domain is changed
+const DefaultDomain = "tempmail.test"
+
+// inboxLifetime is how long inboxes accept mail, longer than any test should run
+const inboxLifetime = 24 * time.Hour
+
+// Server is an SMTP server listening on a random local port
+type Server struct {
+	// Addr is the host:port the SMTP server listens on
+	Addr string
+	// Domain is the domain of the addresses of new inboxes
+	Domain string
+
+	storage *store.Storage
+	bus     *events.LocalBus
+	smtp    *smtp.Server
+}
+
+// NewServer starts an SMTP server on a random port of 127.0.0.1. Close it when done.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for SMTP: %w", err)
+	}
+
+	s := &Server{
+		Addr:    listener.Addr().String(),
+		Domain:  DefaultDomain,
+		storage: store.NewMemoryStorage(),
+		bus:     events.NewLocalBus(),
+	}
+	s.smtp = smtp.NewServer(mailserver.NewBackend(s.storage, s.bus))
+
+	go func() {
+		if err := s.smtp.Serve(listener); err != nil && !errors.Is(err, smtp.ErrServerClosed) {
+			log.Printf("SMTP server stopped: %v", err)
+		}
+	}()
+
+	return s, nil
+}
+
+// Close stops the server, messages already received stay readable
+func (s *Server) Close() error {
+	return s.smtp.Close()
+}
+
+// NewInbox creates an inbox with a random address on the server's domain
+func (s *Server) NewInbox() (*Inbox, error) {
+	localPart := make([]byte, 8)
+	if _, err := rand.Read(localPart); err != nil {
+		return nil, err
+	}
+
+	address := &store.Address{
+		Email:     hex.EncodeToString(localPart) + "@" + strings.ToLower(s.Domain),
+		ExpiresAt: time.Now().Add(inboxLifetime),
+	}
+	if err := s.storage.Addresses.Create(context.Background(), address); err != nil {
+		return nil, fmt.Errorf("failed to create inbox: %w", err)
+	}
+
+	return &Inbox{Address: address.Email, server: s, id: address.ID}, nil
+}
+
+// TB is the part of testing.TB used by NewInbox, which *testing.T and *testing.B satisfy
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...any)
+	Cleanup(func())
+}
+
+// NewInbox starts a server for the test and returns an inbox on it, failing the test when
+// either can't be created. The server is closed when the test ends.
+func NewInbox(tb TB) *Inbox {
+	tb.Helper()
+
+	server, err := NewServer()
+	if err != nil {
+		tb.Fatalf("tempmailtest: %v", err)
+	}
+	tb.Cleanup(func() { server.Close() })
+
+	inbox, err := server.NewInbox()
+	if err != nil {
+		tb.Fatalf("tempmailtest: %v", err)
+	}
+	return inbox
+}
+
+// Inbox is an email address on a Server
+type Inbox struct {
+	// Address is the email address the inbox receives mail for
+	Address string
+
+	server *Server
+	id     int64
+}
+
+// SMTPAddr returns the host:port of the server the inbox is on
+func (i *Inbox) SMTPAddr() string {
+	return i.server.Addr
+}
+
+// Messages gets every message the inbox received, oldest first
+func (i *Inbox) Messages() ([]Message, error) {
+	found, err := i.server.storage.Messages.Find(context.Background(), i.id, store.MessageFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, len(found))
+	for j := range found {
+		attachments, err := i.attachments(int64(found[j].ID))
+		if err != nil {
+			return nil, err
+		}
+		messages[j] = newMessage(&found[j], attachments)
+	}
+	return messages, nil
+}
+
+// attachments loads the attachments of a message with their content
+func (i *Inbox) attachments(messageID int64) ([]Attachment, error) {
+	ctx := context.Background()
+	found, err := i.server.storage.Attachments.GetByMessageID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments := make([]Attachment, len(found))
+	for j := range found {
+		attachment, err := i.server.storage.Attachments.GetByID(ctx, messageID, found[j].ID)
+		if err != nil {
+			return nil, err
+		}
+		attachments[j] = Attachment{Filename: attachment.Filename, ContentType: attachment.ContentType, Content: attachment.Content}
+	}
+	return attachments, nil
+}
+
+// WaitFor returns the oldest message of the inbox matching matcher, waiting for one to arrive
+// if there is none yet. Messages received before the call count, so there is no race with
+// mail sent just before it. It fails with the context's error once ctx is done.
+func (i *Inbox) WaitFor(ctx context.Context, matcher Matcher) (*Message, error) {
+	// Subscribe before the first lookup so a message stored in between isn't missed
+	subscription := i.server.bus.Subscribe(i.id)
+	defer subscription.Close()
+
+	for {
+		messages, err := i.Messages()
+		if err != nil {
+			return nil, err
+		}
+
+		for j := range messages {
+			if matcher == nil || matcher(&messages[j]) {
+				return &messages[j], nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-subscription.C:
+		}
+	}
+}
+
+// WaitForOTP returns the one-time code of the oldest message of the inbox that has one,
+// waiting for it to arrive if needed
+func (i *Inbox) WaitForOTP(ctx context.Context) (string, error) {
+	message, err := i.WaitFor(ctx, HasOTP())
+	if err != nil {
+		return "", err
+	}
+	return message.OTP(), nil
+}
+
+// WaitForLink returns the first link of the given kind, such as LinkVerification, in the
+// oldest message of the inbox that has one, waiting for it to arrive if needed
+func (i *Inbox) WaitForLink(ctx context.Context, kind string) (string, error) {
+	message, err := i.WaitFor(ctx, HasLink(kind))
+	if err != nil {
+		return "", err
+	}
+	return message.Link(kind), nil
+}
@@ -0,0 +1,203 @@
+package tempmailtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"slices"
+	"testing"
+	"time"
+)
+
+const verificationMail = `From: Example <noreply@example.com>
+To: %s
+Subject: Verify your email
+
+Your verification code is 482913.
+
+Or confirm your address at https://app.example.com/verify?token=abc
+`
+
+const resetMail = `From: Example <noreply@example.com>
+To: %s
+Subject: Reset your password
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: text/html; charset=utf-8
+
+<p>Someone asked to reset your password.</p>
+<p><a href="https://app.example.com/reset-password?token=xyz">Choose a new password</a></p>
+--outer
+Content-Type: text/plain; name="report.txt"
+Content-Disposition: attachment; filename="report.txt"
+Content-Transfer-Encoding: base64
+
+aGVsbG8gd29ybGQ=
+--outer--
+`
+
+// send delivers a message to the inbox over SMTP, template gets the address of the inbox
+func send(t *testing.T, inbox *Inbox, template string) {
+	t.Helper()
+
+	message := fmt.Sprintf(template, inbox.Address)
+	if err := smtp.SendMail(inbox.SMTPAddr(), nil, "noreply@example.com", []string{inbox.Address}, []byte(message)); err != nil {
+		t.Fatalf("failed to send mail: %v", err)
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestWaitForReceivedMessage(t *testing.T) {
+	inbox := NewInbox(t)
+	send(t, inbox, verificationMail)
+
+	message, err := inbox.WaitFor(testContext(t), Subject("verify"))
+	if err != nil {
+		t.Fatalf("WaitFor failed: %v", err)
+	}
+	if message.Subject != "Verify your email" || message.From != "noreply@example.com" {
+		t.Errorf("WaitFor returned %q from %q", message.Subject, message.From)
+	}
+	if got := message.Header.Get("To"); got != inbox.Address {
+		t.Errorf("To header = %q, want %q", got, inbox.Address)
+	}
+}
+
+func TestWaitForArrivingMessage(t *testing.T) {
+	inbox := NewInbox(t)
+	// Mail that doesn't match is skipped while waiting
+	send(t, inbox, verificationMail)
+
+	errs := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		message := fmt.Sprintf(resetMail, inbox.Address)
+		errs <- smtp.SendMail(inbox.SMTPAddr(), nil, "noreply@example.com", []string{inbox.Address}, []byte(message))
+	}()
+
+	message, err := inbox.WaitFor(testContext(t), All(From("example.com"), Subject("reset")))
+	if err != nil {
+		t.Fatalf("WaitFor failed: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("failed to send mail: %v", err)
+	}
+	if message.Subject != "Reset your password" {
+		t.Errorf("WaitFor returned %q, want the password reset", message.Subject)
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	inbox := NewInbox(t)
+	send(t, inbox, verificationMail)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := inbox.WaitFor(ctx, Subject("never sent")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitFor returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := inbox.WaitForOTP(ctx); err != nil {
+		t.Errorf("WaitForOTP with a code already received failed once the context was done: %v", err)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	inbox := NewInbox(t)
+	if messages, err := inbox.Messages(); err != nil || len(messages) != 0 {
+		t.Fatalf("Messages of a new inbox = %v, %v, want none", messages, err)
+	}
+
+	send(t, inbox, verificationMail)
+	send(t, inbox, resetMail)
+
+	messages, err := inbox.Messages()
+	if err != nil {
+		t.Fatalf("Messages failed: %v", err)
+	}
+	subjects := []string{}
+	for _, message := range messages {
+		subjects = append(subjects, message.Subject)
+	}
+	if want := []string{"Verify your email", "Reset your password"}; !slices.Equal(subjects, want) {
+		t.Errorf("Messages returned %q, want %q", subjects, want)
+	}
+}
+
+func TestUnknownRecipient(t *testing.T) {
+	inbox := NewInbox(t)
+	other := "nobody@" + DefaultDomain
+
+	err := smtp.SendMail(inbox.SMTPAddr(), nil, "noreply@example.com", []string{other}, []byte("Subject: hi\n\nhi\n"))
+	if err == nil {
+		t.Fatalf("mail to %s was accepted", other)
+	}
+	if messages, _ := inbox.Messages(); len(messages) != 0 {
+		t.Errorf("inbox received %d messages, want none", len(messages))
+	}
+}
+
+func TestCodesAndLinks(t *testing.T) {
+	inbox := NewInbox(t)
+	ctx := testContext(t)
+	send(t, inbox, verificationMail)
+	send(t, inbox, resetMail)
+
+	code, err := inbox.WaitForOTP(ctx)
+	if err != nil || code != "482913" {
+		t.Errorf("WaitForOTP = %q, %v, want 482913", code, err)
+	}
+	link, err := inbox.WaitForLink(ctx, LinkVerification)
+	if err != nil || link != "https://app.example.com/verify?token=abc" {
+		t.Errorf("WaitForLink(verification) = %q, %v", link, err)
+	}
+
+	verification, err := inbox.WaitFor(ctx, HasOTP())
+	if err != nil {
+		t.Fatalf("WaitFor failed: %v", err)
+	}
+	if verification.OTP() != "482913" || verification.VerificationLink() != link || verification.PasswordResetLink() != "" || verification.MagicLink() != "" {
+		t.Errorf("verification message has code %q, links %+v", verification.OTP(), verification.Links)
+	}
+	if verification.Text() == "" || verification.HTML() != "" {
+		t.Errorf("verification message has text %q and html %q, want only text", verification.Text(), verification.HTML())
+	}
+
+	reset, err := inbox.WaitFor(ctx, HasLink(LinkPasswordReset))
+	if err != nil {
+		t.Fatalf("WaitFor failed: %v", err)
+	}
+	if reset.OTP() != "" || reset.PasswordResetLink() != "https://app.example.com/reset-password?token=xyz" {
+		t.Fatalf("reset message has code %q, links %+v", reset.OTP(), reset.Links)
+	}
+	if reset.Links[0].Text != "Choose a new password" {
+		t.Errorf("reset link text = %q, want the anchor text", reset.Links[0].Text)
+	}
+	if reset.HTML() == "" {
+		t.Error("reset message has no html body")
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	inbox := NewInbox(t)
+	send(t, inbox, resetMail)
+
+	message, err := inbox.WaitFor(testContext(t), Any())
+	if err != nil {
+		t.Fatalf("WaitFor failed: %v", err)
+	}
+	if len(message.Attachments) != 1 {
+		t.Fatalf("message has %d attachments, want 1", len(message.Attachments))
+	}
+	attachment := message.Attachments[0]
+	if attachment.Filename != "report.txt" || attachment.ContentType != "text/plain" || string(attachment.Content) != "hello world" {
+		t.Errorf("attachment = %s (%s) %q, want report.txt (text/plain) \"hello world\"", attachment.Filename, attachment.ContentType, attachment.Content)
+	}
+}
@@ -6,7 +6,10 @@ import { useEffect, useState } from "react";
 import { Button } from "@/components/ui/button";
 import { toast } from "@/components/ui/use-toast";
 
-import { generateEmailAddress } from "../lib/api-client";
+import {
+  generateEmailAddress,
+  LOCAL_STORAGE_TOKEN_KEY,
+} from "../lib/api-client";
 
 export function EmailHeader() {
   const [email, setEmail] = useState<string>("");
@@ -51,6 +54,7 @@ export function EmailHeader() {
 
       // Save to localStorage for sharing with Inbox component
       localStorage.setItem("currentEmail", response.data.email);
+      localStorage.setItem(LOCAL_STORAGE_TOKEN_KEY, response.data.token);
 
       // Trigger a storage event for other components to detect
       window.dispatchEvent(new Event("storage"));
@@ -14,12 +14,15 @@ import {
 } from "@/components/ui/card";
 import { Input } from "@/components/ui/input";
 import { Tabs, TabsContent, TabsList, TabsTrigger } from "@/components/ui/tabs";
+import { ToastAction } from "@/components/ui/toast";
 import { toast } from "@/components/ui/use-toast";
 
 import {
   deleteMessage,
   type EmailMessage,
+  getMessage,
   getMessages,
+  restoreMessage,
   updateMessageReadStatus,
 } from "../lib/api-client";
 
@@ -37,7 +40,7 @@ const convertToEmail = (apiMessage: EmailMessage): Email => {
     id: apiMessage.id.toString(),
     from: apiMessage.from_address,
     subject: apiMessage.subject || "No Subject",
-    content: apiMessage.body,
+    content: apiMessage.snippet,
     timestamp: new Date(apiMessage.received_at),
     read: apiMessage.read_at !== null,
   };
@@ -160,6 +163,16 @@ export function Inbox() {
       }
     }
     setSelectedEmail(email);
+
+    // The list only has snippets, load the full body for the detail view
+    const response = await getMessage(Number.parseInt(email.id));
+    if (response.data) {
+      const message = response.data;
+      const content = message.body_html ?? message.body_plain ?? message.snippet;
+      setSelectedEmail((selected) =>
+        selected?.id === email.id ? { ...email, read: true, content } : selected,
+      );
+    }
   };
 
   const handleArchive = (emailId: string) => {
@@ -197,13 +210,35 @@ export function Inbox() {
       return;
     }
 
-    // API call was successful
+    // API call was successful, the message stays in the trash for a while
     toast({
       title: "Message deleted",
-      description: "The message was successfully deleted.",
+      description: "The message was moved to the trash.",
+      action: (
+        <ToastAction altText="Undo" onClick={() => handleRestore(emailId)}>
+          Undo
+        </ToastAction>
+      ),
     });
   };
 
+  const handleRestore = async (emailId: string) => {
+    const response = await restoreMessage(Number.parseInt(emailId));
+
+    if (response.error) {
+      toast({
+        title: "Error restoring message",
+        description: response.error.message,
+        variant: "destructive",
+      });
+      return;
+    }
+
+    if (currentEmail) {
+      fetchMessages(currentEmail);
+    }
+  };
+
   const handleToggleRead = async (emailId: string) => {
     try {
       const response = await updateMessageReadStatus(Number.parseInt(emailId));
@@ -16,16 +16,26 @@ interface ApiResponse<T> {
 
 export interface GeneratedAddress {
   email: string;
+  token: string;
   expires_at: string;
 }
 
+// localStorage key holding the access token of the current address
+export const LOCAL_STORAGE_TOKEN_KEY = "currentEmailToken";
+
 export interface EmailMessage {
   id: number;
   from_address: string;
   subject: string;
-  body: string;
+  snippet: string;
   received_at: string;
   read_at: string | null;
+  has_attachments: boolean;
+}
+
+export interface EmailMessageDetail extends EmailMessage {
+  body_html: string | null;
+  body_plain: string | null;
 }
 
 // Generic fetch helper
@@ -33,11 +43,18 @@ async function apiFetch<T>(
   endpoint: string,
   options: RequestInit = {}
 ): Promise<ApiResponse<T>> {
+  // Inbox endpoints require the token issued with the current address
+  const token =
+    typeof window !== "undefined"
+      ? localStorage.getItem(LOCAL_STORAGE_TOKEN_KEY)
+      : null;
+
   try {
     const response = await fetch(`${API_BASE_URL}${endpoint}`, {
       ...options,
       headers: {
         "Content-Type": "application/json",
+        ...(token ? { Authorization: `Bearer ${token}` } : {}),
         ...options.headers,
       },
     });
@@ -80,6 +97,12 @@ export async function getMessages(
   );
 }
 
+export async function getMessage(
+  id: number
+): Promise<ApiResponse<EmailMessageDetail>> {
+  return apiFetch<EmailMessageDetail>(`/v1/messages/${id}`);
+}
+
 export async function deleteMessage(
   id: number
 ): Promise<ApiResponse<{ message: string }>> {
@@ -88,6 +111,14 @@ export async function deleteMessage(
   });
 }
 
+export async function restoreMessage(
+  id: number
+): Promise<ApiResponse<{ message: string }>> {
+  return apiFetch<{ message: string }>(`/v1/messages/${id}/restore`, {
+    method: "POST",
+  });
+}
+
 export async function updateMessageReadStatus(
   id: number
 ): Promise<ApiResponse<{ message: string }>> {